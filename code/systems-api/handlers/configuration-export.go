@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"fmt"
+	"panda/apigateway/models"
+	"strconv"
+	"strings"
+)
+
+//Configuration file formats with their content type and file extension
+var configurationExportFormats = map[string]struct {
+	contentType string
+	extension   string
+}{
+	"json":  {"application/json; charset=UTF-8", "json"},
+	"yaml":  {"application/yaml; charset=UTF-8", "yaml"},
+	"env":   {"text/plain; charset=UTF-8", "env"},
+	"ini":   {"text/plain; charset=UTF-8", "ini"},
+	"epics": {"text/plain; charset=UTF-8", "substitutions"},
+}
+
+//Formats selected by the Accept header when there is no format parameter
+var configurationExportMediaTypes = map[string]string{
+	"application/yaml":   "yaml",
+	"application/x-yaml": "yaml",
+	"text/yaml":          "yaml",
+}
+
+//Format of the configuration export from the format parameter or the Accept header, json by default
+func configurationExportFormat(formatParam string, accept string) (string, bool) {
+	if formatParam != "" {
+		_, ok := configurationExportFormats[formatParam]
+		return formatParam, ok
+	}
+	for _, mediaType := range strings.Split(accept, ",") {
+		mediaType = strings.TrimSpace(strings.Split(mediaType, ";")[0])
+		if format, ok := configurationExportMediaTypes[mediaType]; ok {
+			return format, true
+		}
+	}
+	return "json", true
+}
+
+//Render the configuration of the System to a file in the format (except json, which is rendered by echo)
+func renderConfiguration(format string, systemCode string, template string, entries []models.Configuration) string {
+	var b strings.Builder
+	switch format {
+	case "yaml":
+		//Go quoted strings are valid YAML double-quoted scalars
+		if len(entries) == 0 {
+			b.WriteString("{}\n")
+		}
+		for _, entry := range entries {
+			fmt.Fprintf(&b, "%s: %s\n", strconv.Quote(entry.Key), strconv.Quote(entry.Value))
+		}
+	case "env":
+		fmt.Fprintf(&b, "# Configuration of %s\n", systemCode)
+		for _, entry := range entries {
+			fmt.Fprintf(&b, "%s=\"%s\"\n", configurationIdentifier(entry.Key), escapeConfigurationValue(entry.Value, `\"$`+"`"))
+		}
+	case "ini":
+		fmt.Fprintf(&b, "; Configuration of %s\n[%s]\n", systemCode, strings.NewReplacer("[", "_", "]", "_").Replace(systemCode))
+		for _, entry := range entries {
+			key := strings.NewReplacer("=", "_", ";", "_", "#", "_", "[", "_", "]", "_").Replace(strings.TrimSpace(entry.Key))
+			fmt.Fprintf(&b, "%s = \"%s\"\n", key, escapeConfigurationValue(entry.Value, `\"`))
+		}
+	case "epics":
+		macros := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			macros = append(macros, fmt.Sprintf("%s=\"%s\"", configurationIdentifier(entry.Key), escapeConfigurationValue(entry.Value, `\"`)))
+		}
+		fmt.Fprintf(&b, "# Configuration of %s\nfile \"%s\" {\n    { %s }\n}\n", systemCode, escapeConfigurationValue(template, `\"`), strings.Join(macros, ", "))
+	}
+	return b.String()
+}
+
+//Key as identifier of environment variable or EPICS macro, invalid characters are replaced by underscore
+func configurationIdentifier(key string) string {
+	identifier := []rune(key)
+	for i, r := range identifier {
+		if !(r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')) {
+			identifier[i] = '_'
+		}
+	}
+	if len(identifier) == 0 || (identifier[0] >= '0' && identifier[0] <= '9') {
+		return "_" + string(identifier)
+	}
+	return string(identifier)
+}
+
+//Escape the value for a double-quoted string, the special characters are escaped by backslash and line breaks as \n
+func escapeConfigurationValue(value string, special string) string {
+	var b strings.Builder
+	for _, r := range value {
+		switch {
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case strings.ContainsRune(special, r):
+			b.WriteRune('\\')
+			b.WriteRune(r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"panda/apigateway/models"
+	"panda/apigateway/services"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+type GrafanaHandlers struct {
+	systemsService services.ISystemsService
+}
+
+//Handlers of the Grafana SimpleJSON datasource protocol. Metrics are codes of the Systems with time-value logs
+//and annotations are the maintenance of the Systems.
+type IGrafanaHandlers interface {
+	TestConnection() echo.HandlerFunc
+	Search() echo.HandlerFunc
+	Query() echo.HandlerFunc
+	Annotations() echo.HandlerFunc
+}
+
+// NewGrafanaHandlers Grafana handlers constructor
+func NewGrafanaHandlers(systemsSvc services.ISystemsService) IGrafanaHandlers {
+	return &GrafanaHandlers{systemsService: systemsSvc}
+}
+
+func (h *GrafanaHandlers) TestConnection() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSON(http.StatusOK, models.ResponseMessage{Message: "Systems API Grafana datasource is working."})
+	}
+}
+
+func (h *GrafanaHandlers) Search() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var request models.GrafanaSearchRequest
+		err := c.Bind(&request)
+		if err != nil {
+			return c.JSON(400, "Invalid search request")
+		}
+		result, err := h.systemsService.GetSystemCodesWithTimeValueLogs(strings.ToLower(request.Target))
+		if err != nil {
+			log.Error(err.Error())
+			return c.JSON(500, "General server error")
+		}
+		return c.JSON(http.StatusOK, result)
+	}
+}
+
+func (h *GrafanaHandlers) Query() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var request models.GrafanaQueryRequest
+		err := c.Bind(&request)
+		if err != nil {
+			return c.JSON(400, "Invalid query request")
+		}
+
+		result := make([]models.GrafanaTimeSeries, 0, len(request.Targets))
+		for _, target := range request.Targets {
+			if target.Target == "" {
+				continue
+			}
+
+			var logs []models.TimeValueLog
+			if request.MaxDataPoints >= 3 {
+				aggregation := models.TimeValueLogAggregation{Function: "lttb", Points: request.MaxDataPoints}
+				logs, err = h.systemsService.GetSystemTimeValueLogsAggregated(target.Target, &request.Range.From, &request.Range.To, aggregation)
+			} else {
+				logs, err = h.systemsService.GetSystemTimeValueLogs(target.Target, &request.Range.From, &request.Range.To)
+			}
+			if err != nil {
+				log.Error(err.Error())
+				return c.JSON(500, "General server error")
+			}
+
+			series := models.GrafanaTimeSeries{Target: target.Target, Datapoints: make([][2]float64, 0, len(logs))}
+			for _, log := range logs {
+				series.Datapoints = append(series.Datapoints, [2]float64{log.Value, float64(log.Time.UnixMilli())})
+			}
+			result = append(result, series)
+		}
+
+		return c.JSON(http.StatusOK, result)
+	}
+}
+
+func (h *GrafanaHandlers) Annotations() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var request models.GrafanaAnnotationRequest
+		err := c.Bind(&request)
+		if err != nil {
+			return c.JSON(400, "Invalid annotations request")
+		}
+
+		//annotation query is an optional System code
+		maintenance, err := h.systemsService.GetSystemMaintenance(models.MaintenanceFilter{
+			SystemCode: strings.TrimSpace(request.Annotation.Query),
+			From:       &request.Range.From,
+			To:         &request.Range.To,
+		})
+		result := make([]models.GrafanaAnnotationEvent, 0)
+		//unknown System has no annotations
+		if errors.Is(err, services.ErrSystemNotFound) {
+			return c.JSON(http.StatusOK, result)
+		}
+		if err != nil {
+			log.Error(err.Error())
+			return c.JSON(500, "General server error")
+		}
+
+		for _, m := range maintenance.Items {
+			result = append(result, models.GrafanaAnnotationEvent{
+				Annotation: request.Annotation,
+				Time:       m.When.UnixMilli(),
+				Title:      "Maintenance of " + m.SystemName,
+				Text:       m.SystemName + " (" + m.SystemCode + ") was maintained by " + m.Username,
+				Tags:       []string{"maintenance", m.SystemCode, m.Username},
+			})
+		}
+
+		return c.JSON(http.StatusOK, result)
+	}
+}
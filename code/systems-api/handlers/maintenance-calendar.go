@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"panda/apigateway/models"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+//Domain part of the UIDs of the calendar events, the UIDs stay the same so calendar clients update the events
+const maintenanceCalendarUidDomain = "systems-api.openapi-tutorial"
+
+const iCalendarTimeLayout = "20060102T150405Z"
+
+var maintenanceTypeTitles = map[string]string{
+	"inspection":  "Inspection",
+	"repair":      "Repair",
+	"calibration": "Calibration",
+}
+
+//Render the maintenance events and the next due dates of the maintenance plans as iCalendar
+func renderMaintenanceCalendar(name string, maintenance []models.Maintenance, plans []models.MaintenancePlan, now time.Time) string {
+	var b strings.Builder
+	writeICalendarLine(&b, "BEGIN:VCALENDAR")
+	writeICalendarLine(&b, "VERSION:2.0")
+	writeICalendarLine(&b, "PRODID:-//OpenAPI Tutorial//Systems API//EN")
+	writeICalendarLine(&b, "CALSCALE:GREGORIAN")
+	writeICalendarLine(&b, "X-WR-CALNAME:"+escapeICalendarText(name))
+
+	for _, m := range maintenance {
+		title, ok := maintenanceTypeTitles[m.Type]
+		if !ok {
+			title = "Maintenance"
+		}
+		description := m.SystemName + " (" + m.SystemCode + ") was maintained by " + m.Username
+		if m.Description != "" {
+			description += "\n" + m.Description
+		}
+
+		writeICalendarLine(&b, "BEGIN:VEVENT")
+		writeICalendarLine(&b, "UID:maintenance-"+m.Id+"@"+maintenanceCalendarUidDomain)
+		writeICalendarLine(&b, "DTSTAMP:"+now.UTC().Format(iCalendarTimeLayout))
+		writeICalendarLine(&b, "DTSTART:"+m.When.UTC().Format(iCalendarTimeLayout))
+		if duration, err := time.ParseDuration(m.Duration); err == nil && duration > 0 {
+			writeICalendarLine(&b, "DTEND:"+m.When.Add(duration).UTC().Format(iCalendarTimeLayout))
+		}
+		writeICalendarLine(&b, "SUMMARY:"+escapeICalendarText(title+" of "+m.SystemName))
+		writeICalendarLine(&b, "DESCRIPTION:"+escapeICalendarText(description))
+		if m.Type != "" {
+			writeICalendarLine(&b, "CATEGORIES:"+escapeICalendarText(m.Type))
+		}
+		writeICalendarLine(&b, "STATUS:CONFIRMED")
+		writeICalendarLine(&b, "END:VEVENT")
+	}
+
+	//only the next due date of the plan is rendered, the event moves with the maintenance done
+	for _, plan := range plans {
+		if plan.NextDue == nil {
+			continue
+		}
+		description := "Planned maintenance of " + plan.SystemName + " (" + plan.SystemCode + ")"
+		if plan.Username != "" {
+			description += " by " + plan.Username
+		}
+		if plan.Overdue {
+			description += ", overdue"
+		}
+		if plan.Description != "" {
+			description += "\n" + plan.Description
+		}
+
+		writeICalendarLine(&b, "BEGIN:VEVENT")
+		writeICalendarLine(&b, "UID:plan-"+plan.Id+"@"+maintenanceCalendarUidDomain)
+		writeICalendarLine(&b, "DTSTAMP:"+now.UTC().Format(iCalendarTimeLayout))
+		writeICalendarLine(&b, "DTSTART:"+plan.NextDue.UTC().Format(iCalendarTimeLayout))
+		writeICalendarLine(&b, "SUMMARY:"+escapeICalendarText(plan.Name+" of "+plan.SystemName))
+		writeICalendarLine(&b, "DESCRIPTION:"+escapeICalendarText(description))
+		if plan.Type != "" {
+			writeICalendarLine(&b, "CATEGORIES:"+escapeICalendarText(plan.Type))
+		}
+		writeICalendarLine(&b, "STATUS:TENTATIVE")
+		writeICalendarLine(&b, "END:VEVENT")
+	}
+
+	writeICalendarLine(&b, "END:VCALENDAR")
+	return b.String()
+}
+
+//Write the content line folded to lines of at most 75 octets, without splitting UTF-8 characters
+func writeICalendarLine(b *strings.Builder, line string) {
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		//continuation lines start with the space
+		limit = 74
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+}
+
+func escapeICalendarText(text string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(text)
+}
@@ -1,35 +1,70 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"panda/apigateway/models"
 	"panda/apigateway/services"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/golang-jwt/jwt"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/gommon/log"
 )
 
 type SystemsHandlers struct {
 	systemsService services.ISystemsService
+	usersService   services.IUsersService
 }
 
 type ISystemsHandlers interface {
 	CreateNewSystem() echo.HandlerFunc
+	UpdateSystem() echo.HandlerFunc
+	PatchSystem() echo.HandlerFunc
+	MoveSystem() echo.HandlerFunc
+	GetSystemMoveHistory() echo.HandlerFunc
 	DeleteSystemByCode() echo.HandlerFunc
 	GetSystemByCode() echo.HandlerFunc
 	GetSystemsByNameOrCode() echo.HandlerFunc
+	GetSystemAncestors() echo.HandlerFunc
+	GetSystemTree() echo.HandlerFunc
+	GetSystemsForest() echo.HandlerFunc
 	GetSystemMaintenance() echo.HandlerFunc
+	CreateSystemMaintenance() echo.HandlerFunc
+	CreateMaintenancePlan() echo.HandlerFunc
+	GetMaintenancePlans() echo.HandlerFunc
+	DeleteMaintenancePlan() echo.HandlerFunc
+	GetDueMaintenance() echo.HandlerFunc
+	GetMaintenanceCalendar() echo.HandlerFunc
+	GetMaintenanceReport() echo.HandlerFunc
 	DeleteConfigurationByKeyAndSystemCode() echo.HandlerFunc
 	GetSystemConfigurationBySystemCode() echo.HandlerFunc
+	GetConfigurationSchema() echo.HandlerFunc
+	SetConfigurationSchema() echo.HandlerFunc
+	GetSystemEffectiveConfiguration() echo.HandlerFunc
+	CompareSystemConfigurations() echo.HandlerFunc
+	UpsertSystemConfiguration() echo.HandlerFunc
+	GetSystemConfigurationRevisions() echo.HandlerFunc
+	DiffSystemConfigurationRevisions() echo.HandlerFunc
+	RollbackSystemConfiguration() echo.HandlerFunc
+	RevealSystemConfigurationSecret() echo.HandlerFunc
+	GetConfigurationSecretAccesses() echo.HandlerFunc
+	ApplyBulkConfiguration() echo.HandlerFunc
+	CreateConfigurationSnapshot() echo.HandlerFunc
+	GetConfigurationSnapshots() echo.HandlerFunc
+	CompareConfigurationSnapshots() echo.HandlerFunc
+	RestoreConfigurationSnapshot() echo.HandlerFunc
 	GetSystemTimeValueLogs() echo.HandlerFunc
+	CreateSystemTimeValueLogs() echo.HandlerFunc
 	RecreateDatabaseData() echo.HandlerFunc
 }
 
 // NewCommentsHandlers Comments handlers constructor
-func NewSystemsHandlers(systemsSvc services.ISystemsService) ISystemsHandlers {
-	return &SystemsHandlers{systemsService: systemsSvc}
+func NewSystemsHandlers(systemsSvc services.ISystemsService, usersSvc services.IUsersService) ISystemsHandlers {
+	return &SystemsHandlers{systemsService: systemsSvc, usersService: usersSvc}
 }
 
 func (h *SystemsHandlers) CreateNewSystem() echo.HandlerFunc {
@@ -48,11 +83,108 @@ func (h *SystemsHandlers) CreateNewSystem() echo.HandlerFunc {
 	}
 }
 
+func (h *SystemsHandlers) UpdateSystem() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		systemCode := c.Param("systemCode")
+		var system models.System
+		err := c.Bind(&system)
+		if err != nil || system.Name == "" || system.Code == "" {
+			return c.JSON(400, "Invalid system data")
+		}
+		//missing type is kept, so the configuration schema of the System does not silently stop applying
+		update := models.SystemUpdate{Name: &system.Name, Code: &system.Code}
+		if system.Type != "" {
+			update.Type = &system.Type
+		}
+		return h.updateSystem(c, systemCode, update)
+	}
+}
+
+func (h *SystemsHandlers) PatchSystem() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		systemCode := c.Param("systemCode")
+		var update models.SystemUpdate
+		err := c.Bind(&update)
+		if err != nil || (update.Name == nil && update.Code == nil && update.Type == nil) || (update.Name != nil && *update.Name == "") || (update.Code != nil && *update.Code == "") {
+			return c.JSON(400, "Invalid system data")
+		}
+		return h.updateSystem(c, systemCode, update)
+	}
+}
+
+func (h *SystemsHandlers) updateSystem(c echo.Context, systemCode string, update models.SystemUpdate) error {
+	result, err := h.systemsService.UpdateSystem(systemCode, update)
+	if err != nil {
+		if errors.Is(err, services.ErrSystemNotFound) {
+			return c.JSON(404, "System not found")
+		}
+		if errors.Is(err, services.ErrSystemCodeConflict) {
+			return c.JSON(409, "System with this code already exists")
+		}
+		log.Error(err.Error())
+		return c.JSON(500, "General server error")
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+func (h *SystemsHandlers) MoveSystem() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		systemCode := c.Param("systemCode")
+		var request models.SystemMoveRequest
+		err := c.Bind(&request)
+		if err != nil {
+			return c.JSON(400, "Invalid move data")
+		}
+		result, err := h.systemsService.MoveSystem(systemCode, request.ParentSystemCode, tokenSubject(c))
+		if err != nil {
+			switch {
+			case errors.Is(err, services.ErrSystemNotFound):
+				return c.JSON(404, "System not found")
+			case errors.Is(err, services.ErrParentSystemNotFound):
+				return c.JSON(404, "Parent system not found")
+			case errors.Is(err, services.ErrSystemHierarchyCycle):
+				return c.JSON(409, "System cannot be moved into its own subtree")
+			}
+			log.Error(err.Error())
+			return c.JSON(500, "General server error")
+		}
+		return c.JSON(http.StatusOK, result)
+	}
+}
+
+func (h *SystemsHandlers) GetSystemMoveHistory() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		systemCode := c.Param("systemCode")
+		result, err := h.systemsService.GetSystemMoveHistory(systemCode)
+		if err != nil {
+			if errors.Is(err, services.ErrSystemNotFound) {
+				return c.JSON(404, "System not found")
+			}
+			log.Error(err.Error())
+			return c.JSON(500, "General server error")
+		}
+		return c.JSON(http.StatusOK, result)
+	}
+}
+
 func (h *SystemsHandlers) DeleteSystemByCode() echo.HandlerFunc {
 	return func(c echo.Context) error {
 		systemCode := c.Param("systemCode")
-		result, err := h.systemsService.DeleteSystemByCode(systemCode)
+		mode := c.QueryParam("mode")
+		if mode == "" {
+			mode = services.DeleteModeRestrict
+		}
+		if mode != services.DeleteModeRestrict && mode != services.DeleteModeCascade && mode != services.DeleteModeReattach {
+			return c.JSON(400, "Invalid mode")
+		}
+		result, err := h.systemsService.DeleteSystemByCode(systemCode, mode, c.QueryParam("dryRun") == "true")
 		if err != nil {
+			if errors.Is(err, services.ErrSystemNotFound) {
+				return c.JSON(404, "System not found")
+			}
+			if errors.Is(err, services.ErrSystemHasSubsystems) {
+				return c.JSON(409, "System has subsystems, use cascade or reattach mode")
+			}
 			log.Error(err.Error())
 			return c.JSON(500, "General server error")
 		}
@@ -68,6 +200,16 @@ func (h *SystemsHandlers) GetSystemByCode() echo.HandlerFunc {
 			log.Error(err.Error())
 			return c.JSON(401, "System not found")
 		}
+		if c.QueryParam("ancestors") == "true" {
+			result.Ancestors, err = h.systemsService.GetSystemAncestors(systemCode)
+			if err != nil {
+				log.Error(err.Error())
+				return c.JSON(500, "General server error")
+			}
+			if len(result.Ancestors) > 0 {
+				result.ParentSystemCode = result.Ancestors[len(result.Ancestors)-1].Code
+			}
+		}
 		return c.JSON(http.StatusOK, result)
 	}
 }
@@ -92,11 +234,316 @@ func (h *SystemsHandlers) GetSystemsByNameOrCode() echo.HandlerFunc {
 	}
 }
 
+func (h *SystemsHandlers) GetSystemAncestors() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		systemCode := c.Param("systemCode")
+		result, err := h.systemsService.GetSystemAncestors(systemCode)
+		if err != nil {
+			if errors.Is(err, services.ErrSystemNotFound) {
+				return c.JSON(404, "System not found")
+			}
+			log.Error(err.Error())
+			return c.JSON(500, "General server error")
+		}
+		return c.JSON(http.StatusOK, result)
+	}
+}
+
+func (h *SystemsHandlers) GetSystemTree() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		systemCode := c.Param("systemCode")
+		depth, err := parseDepthParam(c.QueryParam("depth"))
+		if err != nil {
+			return c.JSON(400, "Invalid depth")
+		}
+		result, err := h.systemsService.GetSystemTree(systemCode, depth, c.QueryParam("childCount") == "true")
+		if err != nil {
+			if errors.Is(err, services.ErrSystemNotFound) {
+				return c.JSON(404, "System not found")
+			}
+			log.Error(err.Error())
+			return c.JSON(500, "General server error")
+		}
+		return c.JSON(http.StatusOK, result)
+	}
+}
+
+func (h *SystemsHandlers) GetSystemsForest() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		depth, err := parseDepthParam(c.QueryParam("depth"))
+		if err != nil {
+			return c.JSON(400, "Invalid depth")
+		}
+		result, err := h.systemsService.GetSystemsForest(depth, c.QueryParam("childCount") == "true")
+		if err != nil {
+			log.Error(err.Error())
+			return c.JSON(500, "General server error")
+		}
+		return c.JSON(http.StatusOK, result)
+	}
+}
+
 func (h *SystemsHandlers) GetSystemMaintenance() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		filter := models.MaintenanceFilter{
+			SystemCode: c.QueryParam("systemCode"),
+			Subtree:    c.QueryParam("subtree") == "true",
+			Username:   c.QueryParam("username"),
+			Type:       c.QueryParam("type"),
+			Cursor:     c.QueryParam("cursor"),
+			Descending: true,
+			Limit:      defaultMaintenanceLimit,
+		}
+		var err error
+		if filter.From, err = parseTimeParam(c.QueryParam("from")); err != nil {
+			return c.JSON(400, "Invalid from")
+		}
+		if filter.To, err = parseTimeParam(c.QueryParam("to")); err != nil {
+			return c.JSON(400, "Invalid to")
+		}
+		if filter.From != nil && filter.To != nil && filter.From.After(*filter.To) {
+			return c.JSON(400, "Invalid time range, from is after to")
+		}
+		if filter.Type != "" && filter.Type != services.MaintenanceTypeInspection && filter.Type != services.MaintenanceTypeRepair && filter.Type != services.MaintenanceTypeCalibration {
+			return c.JSON(400, "Invalid type, use inspection, repair or calibration")
+		}
+		switch c.QueryParam("order") {
+		case "", "desc":
+		case "asc":
+			filter.Descending = false
+		default:
+			return c.JSON(400, "Invalid order, use asc or desc")
+		}
+		if value := c.QueryParam("limit"); value != "" {
+			filter.Limit, err = strconv.Atoi(value)
+			if err != nil || filter.Limit < 1 || filter.Limit > maxMaintenanceLimit {
+				return c.JSON(400, "Invalid limit")
+			}
+		}
+
+		result, err := h.systemsService.GetSystemMaintenance(filter)
+		if err != nil {
+			if errors.Is(err, services.ErrInvalidMaintenanceCursor) {
+				return c.JSON(400, "Invalid cursor, it is valid only with the same filter and order")
+			}
+			if errors.Is(err, services.ErrSystemNotFound) {
+				return c.JSON(404, "System not found")
+			}
+			log.Error(err.Error())
+			return c.JSON(500, "General server error")
+		}
+		return c.JSON(http.StatusOK, result)
+	}
+}
+
+func (h *SystemsHandlers) CreateSystemMaintenance() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		systemCode := c.Param("systemCode")
+		var request models.MaintenanceRequest
+		err := c.Bind(&request)
+		if err != nil {
+			return c.JSON(400, "Invalid maintenance data")
+		}
+		if request.Type != services.MaintenanceTypeInspection && request.Type != services.MaintenanceTypeRepair && request.Type != services.MaintenanceTypeCalibration {
+			return c.JSON(400, "Invalid type, use inspection, repair or calibration")
+		}
+		maintenance := models.Maintenance{Username: request.Username, Type: request.Type, Description: request.Description, When: time.Now()}
+		//the User linked to the token subject by default, maintenance of other Users is logged by the users admin only
+		currentUsername := ""
+		if subject := tokenSubject(c); subject != "" {
+			user, err := h.usersService.GetUserBySubject(subject)
+			if err == nil {
+				currentUsername = user.Username
+			} else if !errors.Is(err, services.ErrUserNotFound) {
+				log.Error(err.Error())
+				return c.JSON(500, "General server error")
+			}
+		}
+		if maintenance.Username == "" {
+			if currentUsername == "" {
+				return c.JSON(400, "No user is linked to the token")
+			}
+			maintenance.Username = currentUsername
+		} else if maintenance.Username != currentUsername && !tokenHasRole(c, usersAdminRole) {
+			return c.JSON(403, "Missing role "+usersAdminRole)
+		}
+		if request.When != nil {
+			maintenance.When = *request.When
+		}
+		if request.Duration != "" {
+			duration, err := time.ParseDuration(request.Duration)
+			if err != nil || duration < 0 {
+				return c.JSON(400, "Invalid duration")
+			}
+			maintenance.Duration = duration.String()
+		}
+
+		result, err := h.systemsService.CreateSystemMaintenance(systemCode, maintenance)
+		if err != nil {
+			if errors.Is(err, services.ErrSystemNotFound) {
+				return c.JSON(404, "System not found")
+			}
+			if errors.Is(err, services.ErrUserNotFound) {
+				return c.JSON(400, "User not found")
+			}
+			if errors.Is(err, services.ErrUserInactive) {
+				return c.JSON(400, "User is not active")
+			}
+			log.Error(err.Error())
+			return c.JSON(500, "General server error")
+		}
+		return c.JSON(http.StatusOK, result)
+	}
+}
+
+func (h *SystemsHandlers) CreateMaintenancePlan() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		systemCode := c.Param("systemCode")
+		var plan models.MaintenancePlan
+		err := c.Bind(&plan)
+		if err != nil {
+			return c.JSON(400, "Invalid maintenance plan data")
+		}
+		if plan.Start.IsZero() {
+			plan.Start = time.Now()
+		}
+		result, err := h.systemsService.CreateMaintenancePlan(systemCode, plan)
+		if err != nil {
+			if errors.Is(err, services.ErrInvalidMaintenancePlan) {
+				return c.JSON(400, err.Error())
+			}
+			if errors.Is(err, services.ErrSystemNotFound) {
+				return c.JSON(404, "System not found")
+			}
+			log.Error(err.Error())
+			return c.JSON(500, "General server error")
+		}
+		return c.JSON(http.StatusOK, result)
+	}
+}
+
+func (h *SystemsHandlers) GetMaintenancePlans() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		systemCode := c.Param("systemCode")
+		result, err := h.systemsService.GetMaintenancePlans(systemCode)
+		if err != nil {
+			if errors.Is(err, services.ErrSystemNotFound) {
+				return c.JSON(404, "System not found")
+			}
+			log.Error(err.Error())
+			return c.JSON(500, "General server error")
+		}
+		return c.JSON(http.StatusOK, result)
+	}
+}
+
+func (h *SystemsHandlers) DeleteMaintenancePlan() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		systemCode := c.Param("systemCode")
+		planId := c.Param("planId")
+		result, err := h.systemsService.DeleteMaintenancePlan(systemCode, planId)
+		if err != nil {
+			if errors.Is(err, services.ErrMaintenancePlanNotFound) {
+				return c.JSON(404, "Maintenance plan not found")
+			}
+			log.Error(err.Error())
+			return c.JSON(500, "General server error")
+		}
+		return c.JSON(http.StatusOK, result)
+	}
+}
+
+func (h *SystemsHandlers) GetDueMaintenance() echo.HandlerFunc {
 	return func(c echo.Context) error {
 		systemCode := c.QueryParam("systemCode")
-		result, err := h.systemsService.GetSystemMaintenance(systemCode)
+		days := defaultDueMaintenanceDays
+		if value := c.QueryParam("days"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 0 {
+				return c.JSON(400, "Invalid days")
+			}
+			days = parsed
+		}
+		result, err := h.systemsService.GetDueMaintenance(systemCode, time.Now().AddDate(0, 0, days))
 		if err != nil {
+			if errors.Is(err, services.ErrSystemNotFound) {
+				return c.JSON(404, "System not found")
+			}
+			log.Error(err.Error())
+			return c.JSON(500, "General server error")
+		}
+		return c.JSON(http.StatusOK, result)
+	}
+}
+
+func (h *SystemsHandlers) GetMaintenanceCalendar() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		systemCode := c.QueryParam("systemCode")
+		subtree := c.QueryParam("subtree") == "true"
+		username := c.QueryParam("username")
+
+		plans, err := h.systemsService.FindMaintenancePlans(systemCode, subtree, username)
+		if err != nil {
+			if errors.Is(err, services.ErrSystemNotFound) {
+				return c.JSON(404, "System not found")
+			}
+			log.Error(err.Error())
+			return c.JSON(500, "General server error")
+		}
+		maintenance, err := h.systemsService.GetSystemMaintenance(models.MaintenanceFilter{SystemCode: systemCode, Subtree: subtree, Username: username})
+		if err != nil {
+			log.Error(err.Error())
+			return c.JSON(500, "General server error")
+		}
+
+		name := "Maintenance"
+		if systemCode != "" {
+			name += " of " + systemCode
+		}
+		if username != "" {
+			name += " by " + username
+		}
+		return c.Blob(http.StatusOK, "text/calendar; charset=UTF-8", []byte(renderMaintenanceCalendar(name, maintenance.Items, plans, time.Now())))
+	}
+}
+
+func (h *SystemsHandlers) GetMaintenanceReport() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		systemCode := c.QueryParam("systemCode")
+		if systemCode == "" {
+			return c.JSON(400, "Invalid system code")
+		}
+		period := c.QueryParam("period")
+		if period == "" {
+			period = services.MaintenancePeriodMonth
+		}
+		if period != services.MaintenancePeriodWeek && period != services.MaintenancePeriodMonth && period != services.MaintenancePeriodQuarter && period != services.MaintenancePeriodYear {
+			return c.JSON(400, "Invalid period, use week, month, quarter or year")
+		}
+		from, err := parseTimeParam(c.QueryParam("from"))
+		if err != nil {
+			return c.JSON(400, "Invalid from")
+		}
+		to, err := parseTimeParam(c.QueryParam("to"))
+		if err != nil {
+			return c.JSON(400, "Invalid to")
+		}
+		if from != nil && to != nil && from.After(*to) {
+			return c.JSON(400, "Invalid time range, from is after to")
+		}
+		top := defaultTopTechnicians
+		if value := c.QueryParam("top"); value != "" {
+			top, err = strconv.Atoi(value)
+			if err != nil || top < 0 {
+				return c.JSON(400, "Invalid top")
+			}
+		}
+
+		result, err := h.systemsService.GetMaintenanceReport(systemCode, from, to, period, top)
+		if err != nil {
+			if errors.Is(err, services.ErrSystemNotFound) {
+				return c.JSON(404, "System not found")
+			}
 			log.Error(err.Error())
 			return c.JSON(500, "General server error")
 		}
@@ -108,8 +555,11 @@ func (h *SystemsHandlers) DeleteConfigurationByKeyAndSystemCode() echo.HandlerFu
 	return func(c echo.Context) error {
 		systemCode := c.Param("systemCode")
 		key := c.QueryParam("key")
-		result, err := h.systemsService.DeleteConfigurationByKeyAndSystemCode(systemCode, key)
+		result, err := h.systemsService.DeleteConfigurationByKeyAndSystemCode(systemCode, key, tokenSubject(c))
 		if err != nil {
+			if errors.Is(err, services.ErrSystemNotFound) {
+				return c.JSON(404, "System not found")
+			}
 			log.Error(err.Error())
 			return c.JSON(500, "General server error")
 		}
@@ -120,7 +570,73 @@ func (h *SystemsHandlers) DeleteConfigurationByKeyAndSystemCode() echo.HandlerFu
 func (h *SystemsHandlers) GetSystemConfigurationBySystemCode() echo.HandlerFunc {
 	return func(c echo.Context) error {
 		systemCode := c.Param("systemCode")
-		result, err := h.systemsService.GetSystemConfigurationBySystemCode(systemCode)
+
+		at, err := parseTimeParam(c.QueryParam("at"))
+		if err != nil {
+			return c.JSON(400, "Invalid at")
+		}
+		var revision *int64
+		if value := c.QueryParam("revision"); value != "" {
+			parsed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return c.JSON(400, "Invalid revision")
+			}
+			revision = &parsed
+		}
+
+		effective := c.QueryParam("effective") == "true"
+		if effective && (revision != nil || at != nil) {
+			return c.JSON(400, "Effective configuration cannot be combined with revision or at")
+		}
+		format, ok := configurationExportFormat(c.QueryParam("format"), c.Request().Header.Get(echo.HeaderAccept))
+		if !ok {
+			return c.JSON(400, "Invalid format")
+		}
+
+		var result []models.Configuration
+		var effectiveResult []models.EffectiveConfiguration
+		if effective {
+			effectiveResult, err = h.systemsService.GetSystemEffectiveConfiguration(systemCode)
+			for _, entry := range effectiveResult {
+				result = append(result, models.Configuration{Key: entry.Key, Value: entry.Value, Secret: entry.Secret})
+			}
+		} else if revision != nil || at != nil {
+			result, err = h.systemsService.GetSystemConfigurationAt(systemCode, revision, at)
+		} else {
+			result, err = h.systemsService.GetSystemConfigurationBySystemCode(systemCode)
+		}
+		if err != nil {
+			if errors.Is(err, services.ErrSystemNotFound) {
+				return c.JSON(404, "System not found")
+			}
+			if errors.Is(err, services.ErrConfigurationRevisionNotFound) {
+				return c.JSON(404, "Configuration revision not found")
+			}
+			log.Error(err.Error())
+			return c.JSON(500, "General server error")
+		}
+
+		if format != "json" || c.QueryParam("format") != "" {
+			c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", systemCode+"."+configurationExportFormats[format].extension))
+		}
+		if format != "json" {
+			template := c.QueryParam("template")
+			if template == "" {
+				template = systemCode + ".template"
+			}
+			return c.Blob(http.StatusOK, configurationExportFormats[format].contentType, []byte(renderConfiguration(format, systemCode, template, result)))
+		}
+		if effective {
+			return c.JSON(http.StatusOK, effectiveResult)
+		}
+		return c.JSON(http.StatusOK, result)
+	}
+}
+
+func (h *SystemsHandlers) GetConfigurationSchema() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		systemType := c.Param("systemType")
+		result, err := h.systemsService.GetConfigurationSchema(systemType)
 		if err != nil {
 			log.Error(err.Error())
 			return c.JSON(500, "General server error")
@@ -129,12 +645,401 @@ func (h *SystemsHandlers) GetSystemConfigurationBySystemCode() echo.HandlerFunc
 	}
 }
 
+func (h *SystemsHandlers) SetConfigurationSchema() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		systemType := c.Param("systemType")
+		var keys []models.ConfigurationKeySchema
+		err := c.Bind(&keys)
+		if err != nil {
+			return c.JSON(400, "Invalid configuration schema data")
+		}
+		result, err := h.systemsService.SetConfigurationSchema(systemType, keys)
+		if err != nil {
+			var validationErr *services.ConfigurationValidationError
+			if errors.As(err, &validationErr) {
+				return c.JSON(400, validationErr.Error())
+			}
+			log.Error(err.Error())
+			return c.JSON(500, "General server error")
+		}
+		return c.JSON(http.StatusOK, result)
+	}
+}
+
+func (h *SystemsHandlers) GetSystemEffectiveConfiguration() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		systemCode := c.Param("systemCode")
+		result, err := h.systemsService.GetSystemEffectiveConfiguration(systemCode)
+		if err != nil {
+			if errors.Is(err, services.ErrSystemNotFound) {
+				return c.JSON(404, "System not found")
+			}
+			log.Error(err.Error())
+			return c.JSON(500, "General server error")
+		}
+		return c.JSON(http.StatusOK, result)
+	}
+}
+
+func (h *SystemsHandlers) CompareSystemConfigurations() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		left := c.QueryParam("left")
+		right := c.QueryParam("right")
+		if left == "" || right == "" {
+			return c.JSON(400, "Invalid left or right system code")
+		}
+
+		var result interface{}
+		var err error
+		if c.QueryParam("subtree") == "true" {
+			result, err = h.systemsService.CompareSubtreeConfigurations(left, right)
+		} else {
+			result, err = h.systemsService.CompareSystemConfigurations(left, right)
+		}
+		if err != nil {
+			if errors.Is(err, services.ErrSystemNotFound) {
+				return c.JSON(404, "System not found")
+			}
+			if errors.Is(err, services.ErrSystemPathConflict) {
+				return c.JSON(409, err.Error())
+			}
+			log.Error(err.Error())
+			return c.JSON(500, "General server error")
+		}
+		return c.JSON(http.StatusOK, result)
+	}
+}
+
+func (h *SystemsHandlers) GetSystemConfigurationRevisions() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		systemCode := c.Param("systemCode")
+		result, err := h.systemsService.GetSystemConfigurationRevisions(systemCode)
+		if err != nil {
+			if errors.Is(err, services.ErrSystemNotFound) {
+				return c.JSON(404, "System not found")
+			}
+			log.Error(err.Error())
+			return c.JSON(500, "General server error")
+		}
+		return c.JSON(http.StatusOK, result)
+	}
+}
+
+func (h *SystemsHandlers) DiffSystemConfigurationRevisions() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		systemCode := c.Param("systemCode")
+		from, err := strconv.ParseInt(c.QueryParam("from"), 10, 64)
+		if err != nil {
+			return c.JSON(400, "Invalid from")
+		}
+		to, err := strconv.ParseInt(c.QueryParam("to"), 10, 64)
+		if err != nil {
+			return c.JSON(400, "Invalid to")
+		}
+		result, err := h.systemsService.DiffSystemConfigurationRevisions(systemCode, from, to)
+		if err != nil {
+			if errors.Is(err, services.ErrSystemNotFound) {
+				return c.JSON(404, "System not found")
+			}
+			if errors.Is(err, services.ErrConfigurationRevisionNotFound) {
+				return c.JSON(404, "Configuration revision not found")
+			}
+			log.Error(err.Error())
+			return c.JSON(500, "General server error")
+		}
+		return c.JSON(http.StatusOK, result)
+	}
+}
+
+func (h *SystemsHandlers) RollbackSystemConfiguration() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		systemCode := c.Param("systemCode")
+		revision, err := strconv.ParseInt(c.Param("revision"), 10, 64)
+		if err != nil {
+			return c.JSON(400, "Invalid revision")
+		}
+		result, err := h.systemsService.RollbackSystemConfiguration(systemCode, revision, tokenSubject(c))
+		if err != nil {
+			var validationErr *services.ConfigurationValidationError
+			if errors.As(err, &validationErr) {
+				return c.JSON(400, validationErr.Error())
+			}
+			if errors.Is(err, services.ErrSystemNotFound) {
+				return c.JSON(404, "System not found")
+			}
+			if errors.Is(err, services.ErrConfigurationRevisionNotFound) {
+				return c.JSON(404, "Configuration revision not found")
+			}
+			log.Error(err.Error())
+			return c.JSON(500, "General server error")
+		}
+		return c.JSON(http.StatusOK, result)
+	}
+}
+
+func (h *SystemsHandlers) RevealSystemConfigurationSecret() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if !tokenHasRole(c, configurationSecretsRole) {
+			return c.JSON(403, "Missing role "+configurationSecretsRole)
+		}
+		systemCode := c.Param("systemCode")
+		key := c.Param("key")
+		result, err := h.systemsService.RevealSystemConfigurationSecret(systemCode, key, tokenSubject(c))
+		if err != nil {
+			if errors.Is(err, services.ErrSystemNotFound) {
+				return c.JSON(404, "System not found")
+			}
+			if errors.Is(err, services.ErrConfigurationSecretNotFound) {
+				return c.JSON(404, "Secret configuration key not found")
+			}
+			log.Error(err.Error())
+			return c.JSON(500, "General server error")
+		}
+		log.Infof("Secret configuration %s of system %s revealed to %s", key, systemCode, tokenSubject(c))
+		return c.JSON(http.StatusOK, result)
+	}
+}
+
+func (h *SystemsHandlers) GetConfigurationSecretAccesses() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if !tokenHasRole(c, configurationSecretsRole) {
+			return c.JSON(403, "Missing role "+configurationSecretsRole)
+		}
+		result, err := h.systemsService.GetConfigurationSecretAccesses(c.Param("systemCode"), c.QueryParam("key"))
+		if err != nil {
+			log.Error(err.Error())
+			return c.JSON(500, "General server error")
+		}
+		return c.JSON(http.StatusOK, result)
+	}
+}
+
+func (h *SystemsHandlers) UpsertSystemConfiguration() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		systemCode := c.Param("systemCode")
+
+		var entries []models.Configuration
+		err := c.Bind(&entries)
+		if err != nil || len(entries) == 0 {
+			return c.JSON(400, "Invalid configuration data")
+		}
+		keys := make(map[string]bool, len(entries))
+		for _, entry := range entries {
+			if entry.Key == "" || keys[entry.Key] {
+				return c.JSON(400, "Invalid configuration data, keys must be non-empty and unique")
+			}
+			keys[entry.Key] = true
+		}
+
+		result, err := h.systemsService.UpsertSystemConfiguration(systemCode, entries, tokenSubject(c))
+		if err != nil {
+			var validationErr *services.ConfigurationValidationError
+			if errors.As(err, &validationErr) {
+				return c.JSON(400, validationErr.Error())
+			}
+			if errors.Is(err, services.ErrSystemNotFound) {
+				return c.JSON(404, "System not found")
+			}
+			log.Error(err.Error())
+			return c.JSON(500, "General server error")
+		}
+		return c.JSON(http.StatusOK, result)
+	}
+}
+
+func (h *SystemsHandlers) ApplyBulkConfiguration() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var request models.BulkConfigurationRequest
+		err := c.Bind(&request)
+		if err != nil {
+			return c.JSON(400, "Invalid bulk configuration data")
+		}
+		if request.SubtreeSystemCode == "" && request.CodePattern == "" && request.SearchText == "" {
+			return c.JSON(400, "Invalid bulk configuration data, subtreeSystemCode, codePattern or searchText is required")
+		}
+		if len(request.Set) == 0 && len(request.Remove) == 0 {
+			return c.JSON(400, "Invalid bulk configuration data, no keys to set or remove")
+		}
+		keys := make(map[string]bool, len(request.Set)+len(request.Remove))
+		for _, entry := range request.Set {
+			if entry.Key == "" || keys[entry.Key] {
+				return c.JSON(400, "Invalid bulk configuration data, keys must be non-empty and unique")
+			}
+			keys[entry.Key] = true
+		}
+		for _, key := range request.Remove {
+			if key == "" || keys[key] {
+				return c.JSON(400, "Invalid bulk configuration data, keys must be non-empty and unique")
+			}
+			keys[key] = true
+		}
+
+		result, err := h.systemsService.ApplyBulkConfiguration(request, c.QueryParam("dryRun") == "true", tokenSubject(c))
+		if err != nil {
+			if errors.Is(err, services.ErrSystemNotFound) {
+				return c.JSON(404, "System not found")
+			}
+			log.Error(err.Error())
+			return c.JSON(500, "General server error")
+		}
+		if !result.DryRun && !result.Applied {
+			return c.JSON(400, result)
+		}
+		return c.JSON(http.StatusOK, result)
+	}
+}
+
+func (h *SystemsHandlers) CreateConfigurationSnapshot() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		systemCode := c.Param("systemCode")
+		var request models.ConfigurationSnapshotRequest
+		err := c.Bind(&request)
+		if err != nil || request.Name == "" {
+			return c.JSON(400, "Invalid snapshot data")
+		}
+		result, err := h.systemsService.CreateConfigurationSnapshot(systemCode, request.Name, tokenSubject(c))
+		if err != nil {
+			if errors.Is(err, services.ErrSystemNotFound) {
+				return c.JSON(404, "System not found")
+			}
+			if errors.Is(err, services.ErrConfigurationSnapshotConflict) {
+				return c.JSON(409, "Configuration snapshot with this name already exists")
+			}
+			log.Error(err.Error())
+			return c.JSON(500, "General server error")
+		}
+		return c.JSON(http.StatusOK, result)
+	}
+}
+
+func (h *SystemsHandlers) GetConfigurationSnapshots() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		systemCode := c.Param("systemCode")
+		result, err := h.systemsService.GetConfigurationSnapshots(systemCode)
+		if err != nil {
+			if errors.Is(err, services.ErrSystemNotFound) {
+				return c.JSON(404, "System not found")
+			}
+			log.Error(err.Error())
+			return c.JSON(500, "General server error")
+		}
+		return c.JSON(http.StatusOK, result)
+	}
+}
+
+func (h *SystemsHandlers) CompareConfigurationSnapshots() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		systemCode := c.Param("systemCode")
+		from := c.QueryParam("from")
+		if from == "" {
+			return c.JSON(400, "Invalid from")
+		}
+		result, err := h.systemsService.CompareConfigurationSnapshots(systemCode, from, c.QueryParam("to"))
+		if err != nil {
+			if errors.Is(err, services.ErrSystemNotFound) {
+				return c.JSON(404, "System not found")
+			}
+			if errors.Is(err, services.ErrConfigurationSnapshotNotFound) {
+				return c.JSON(404, "Configuration snapshot not found")
+			}
+			log.Error(err.Error())
+			return c.JSON(500, "General server error")
+		}
+		return c.JSON(http.StatusOK, result)
+	}
+}
+
+func (h *SystemsHandlers) RestoreConfigurationSnapshot() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		systemCode := c.Param("systemCode")
+		name := c.Param("name")
+		result, err := h.systemsService.RestoreConfigurationSnapshot(systemCode, name, c.QueryParam("dryRun") == "true", tokenSubject(c))
+		if err != nil {
+			var validationErr *services.ConfigurationValidationError
+			if errors.As(err, &validationErr) {
+				return c.JSON(400, validationErr.Error())
+			}
+			if errors.Is(err, services.ErrSystemNotFound) {
+				return c.JSON(404, "System not found")
+			}
+			if errors.Is(err, services.ErrConfigurationSnapshotNotFound) {
+				return c.JSON(404, "Configuration snapshot not found")
+			}
+			log.Error(err.Error())
+			return c.JSON(500, "General server error")
+		}
+		return c.JSON(http.StatusOK, result)
+	}
+}
+
 func (h *SystemsHandlers) GetSystemTimeValueLogs() echo.HandlerFunc {
 	return func(c echo.Context) error {
 		systemCode := c.Param("systemCode")
 
-		result, err := h.systemsService.GetSystemTimeValueLogs(systemCode)
+		from, err := parseTimeParam(c.QueryParam("from"))
+		if err != nil {
+			return c.JSON(400, "Invalid from")
+		}
+		to, err := parseTimeParam(c.QueryParam("to"))
+		if err != nil {
+			return c.JSON(400, "Invalid to")
+		}
+		if from != nil && to != nil && from.After(*to) {
+			return c.JSON(400, "Invalid time range, from is after to")
+		}
+
+		var result []models.TimeValueLog
+		if function := c.QueryParam("aggregation"); function != "" {
+			aggregation := models.TimeValueLogAggregation{Function: function}
+			if function == "lttb" {
+				points, err := strconv.Atoi(c.QueryParam("points"))
+				if err != nil || points < 3 || points > maxTimeValueLogPoints {
+					return c.JSON(400, "Invalid points")
+				}
+				aggregation.Points = points
+			} else if validBucketAggregations[function] {
+				bucket, err := time.ParseDuration(c.QueryParam("bucket"))
+				if err != nil || bucket < time.Millisecond {
+					return c.JSON(400, "Invalid bucket")
+				}
+				//the number of buckets is bounded only by the closed time range
+				if from == nil || to == nil {
+					return c.JSON(400, "Bucket aggregation requires from and to")
+				}
+				if to.Sub(*from)/bucket > maxTimeValueLogPoints {
+					return c.JSON(400, "Too many buckets, use bigger bucket or shorter time range")
+				}
+				aggregation.Bucket = bucket
+			} else {
+				return c.JSON(400, "Invalid aggregation")
+			}
+			result, err = h.systemsService.GetSystemTimeValueLogsAggregated(systemCode, from, to, aggregation)
+		} else {
+			result, err = h.systemsService.GetSystemTimeValueLogs(systemCode, from, to)
+		}
+		if err != nil {
+			log.Error(err.Error())
+			return c.JSON(500, "General server error")
+		}
+		return c.JSON(http.StatusOK, result)
+	}
+}
+
+func (h *SystemsHandlers) CreateSystemTimeValueLogs() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		systemCode := c.Param("systemCode")
+
+		var logs []models.TimeValueLog
+		err := c.Bind(&logs)
+		if err != nil || len(logs) == 0 {
+			return c.JSON(400, "Invalid time-value logs data")
+		}
+
+		result, err := h.systemsService.CreateSystemTimeValueLogs(systemCode, logs)
 		if err != nil {
+			if errors.Is(err, services.ErrSystemNotFound) {
+				return c.JSON(404, "System not found")
+			}
 			log.Error(err.Error())
 			return c.JSON(500, "General server error")
 		}
@@ -153,3 +1058,93 @@ func (h *SystemsHandlers) RecreateDatabaseData() echo.HandlerFunc {
 		return c.JSON(http.StatusOK, result)
 	}
 }
+
+//Maximum number of aggregated or downsampled time-value log points a client can ask for
+const maxTimeValueLogPoints = 10000
+
+var validBucketAggregations = map[string]bool{"min": true, "max": true, "avg": true, "count": true, "first": true, "last": true}
+
+//Accepted formats of the time query parameters. Values without time zone are taken as UTC as neo4j does.
+var timeParamLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+//Parse optional time query parameter in RFC3339/ISO format. Empty value returns nil.
+func parseTimeParam(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var err error
+	for _, layout := range timeParamLayouts {
+		var t time.Time
+		if t, err = time.Parse(layout, value); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, err
+}
+
+//Parse optional depth query parameter of the hierarchy, empty value returns -1 as unlimited depth
+func parseDepthParam(value string) (int, error) {
+	if value == "" {
+		return -1, nil
+	}
+	depth, err := strconv.Atoi(value)
+	if err != nil || depth < 0 {
+		return 0, errors.New("Invalid depth: " + value)
+	}
+	return depth, nil
+}
+
+//Subject of the JWT token validated by the JWT middleware, empty if there is no token
+func tokenSubject(c echo.Context) string {
+	token, ok := c.Get("user").(*jwt.Token)
+	if !ok {
+		return ""
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return ""
+	}
+	subject, _ := claims["sub"].(string)
+	return subject
+}
+
+//Page size of the maintenance listing
+const (
+	defaultMaintenanceLimit = 100
+	maxMaintenanceLimit     = 1000
+)
+
+//How many most active technicians are in the maintenance report by default
+const defaultTopTechnicians = 3
+
+//How many days ahead the upcoming maintenance is listed by default
+const defaultDueMaintenanceDays = 30
+
+//Role of the JWT roles claim required to reveal the secret configuration values
+const configurationSecretsRole = "config-secrets"
+
+//Role of the JWT roles claim required to manage the Users and to link them to the token subjects
+const usersAdminRole = "users-admin"
+
+func tokenHasRole(c echo.Context, role string) bool {
+	token, ok := c.Get("user").(*jwt.Token)
+	if !ok {
+		return false
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return false
+	}
+	roles, _ := claims["roles"].([]interface{})
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"panda/apigateway/models"
+	"panda/apigateway/services"
+	"sort"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+	"golang.org/x/net/websocket"
+)
+
+//Interval of the keep-alive messages, so proxies do not close idle streams
+const timeValueStreamHeartbeat = 15 * time.Second
+
+type TimeValueStreamHandlers struct {
+	systemsService       services.ISystemsService
+	timeValueBroadcaster services.ITimeValueBroadcaster
+}
+
+//Live streams of the newly written time-value logs of a System or of its whole subtree
+type ITimeValueStreamHandlers interface {
+	StreamSystemTimeValueLogsSSE() echo.HandlerFunc
+	StreamSystemTimeValueLogsWebSocket() echo.HandlerFunc
+}
+
+// NewTimeValueStreamHandlers Time-value stream handlers constructor
+func NewTimeValueStreamHandlers(systemsSvc services.ISystemsService, broadcaster services.ITimeValueBroadcaster) ITimeValueStreamHandlers {
+	return &TimeValueStreamHandlers{systemsService: systemsSvc, timeValueBroadcaster: broadcaster}
+}
+
+//One opened stream, the replayed logs are sent first and then the live ones
+type timeValueStream struct {
+	subscription *services.TimeValueSubscription
+	replay       []models.TimeValueLogEvent
+	replayed     map[timeValueStreamKey]int
+}
+
+//Identity of the replayed log, the same log can be both replayed and published while the replay is loaded
+type timeValueStreamKey struct {
+	systemCode string
+	time       int64
+	value      float64
+}
+
+func newTimeValueStreamKey(event models.TimeValueLogEvent) timeValueStreamKey {
+	return timeValueStreamKey{systemCode: event.SystemCode, time: event.Time.UnixNano(), value: event.Value}
+}
+
+func (h *TimeValueStreamHandlers) StreamSystemTimeValueLogsSSE() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		stream, errResponse := h.openStream(c)
+		if errResponse != nil {
+			return errResponse
+		}
+		defer h.timeValueBroadcaster.Unsubscribe(stream.subscription)
+
+		response := c.Response()
+		response.Header().Set(echo.HeaderContentType, "text/event-stream")
+		response.Header().Set("Cache-Control", "no-cache")
+		response.Header().Set("Connection", "keep-alive")
+		response.WriteHeader(http.StatusOK)
+		response.Flush()
+
+		return stream.run(c.Request().Context().Done(),
+			func(event models.TimeValueLogEvent) error {
+				data, err := json.Marshal(event)
+				if err != nil {
+					return err
+				}
+				_, err = fmt.Fprintf(response, "event: log\ndata: %s\n\n", data)
+				response.Flush()
+				return err
+			},
+			func() error {
+				_, err := fmt.Fprint(response, ": heartbeat\n\n")
+				response.Flush()
+				return err
+			},
+			func() error {
+				_, err := fmt.Fprint(response, "event: overflow\ndata: \"Stream is too slow, reconnect with since parameter\"\n\n")
+				response.Flush()
+				return err
+			})
+	}
+}
+
+func (h *TimeValueStreamHandlers) StreamSystemTimeValueLogsWebSocket() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		stream, errResponse := h.openStream(c)
+		if errResponse != nil {
+			return errResponse
+		}
+		defer h.timeValueBroadcaster.Unsubscribe(stream.subscription)
+
+		//origin is not checked by the handshake, cross origin access is allowed as for the rest of the API
+		server := websocket.Server{Handler: func(ws *websocket.Conn) {
+			defer ws.Close()
+
+			//incoming messages are ignored, reading only detects the closed connection
+			closed := make(chan struct{})
+			go func() {
+				defer close(closed)
+				var message string
+				for websocket.Message.Receive(ws, &message) == nil {
+				}
+			}()
+
+			err := stream.run(closed,
+				func(event models.TimeValueLogEvent) error {
+					return websocket.JSON.Send(ws, models.TimeValueStreamMessage{Type: "log", Log: &event})
+				},
+				func() error {
+					return websocket.JSON.Send(ws, models.TimeValueStreamMessage{Type: "heartbeat"})
+				},
+				func() error {
+					return websocket.JSON.Send(ws, models.TimeValueStreamMessage{Type: "overflow"})
+				})
+			if err != nil {
+				log.Debug(err.Error())
+			}
+		}}
+		server.ServeHTTP(c.Response(), c.Request())
+		return nil
+	}
+}
+
+//Validate the stream request, subscribe to the live logs and load the logs to replay.
+//Returned error is already the response to the invalid request.
+//The subtree is resolved when the stream is opened, Systems moved into the subtree later are streamed after reconnect.
+func (h *TimeValueStreamHandlers) openStream(c echo.Context) (*timeValueStream, error) {
+	systemCode := c.Param("systemCode")
+
+	since, err := parseTimeParam(c.QueryParam("since"))
+	if err != nil {
+		return nil, c.JSON(400, "Invalid since")
+	}
+
+	systemCodes, err := h.systemsService.GetSubsystemCodes(systemCode)
+	if err != nil {
+		if errors.Is(err, services.ErrSystemNotFound) {
+			return nil, c.JSON(404, "System not found")
+		}
+		log.Error(err.Error())
+		return nil, c.JSON(500, "General server error")
+	}
+	if c.QueryParam("subtree") != "true" {
+		systemCodes = systemCodes[:1]
+	}
+
+	//subscribe before the replay is loaded, so no log written in between is lost
+	stream := &timeValueStream{
+		subscription: h.timeValueBroadcaster.Subscribe(systemCodes),
+		replay:       make([]models.TimeValueLogEvent, 0),
+		replayed:     make(map[timeValueStreamKey]int),
+	}
+
+	if since != nil {
+		for _, code := range systemCodes {
+			logs, err := h.systemsService.GetSystemTimeValueLogs(code, since, nil)
+			if err != nil {
+				h.timeValueBroadcaster.Unsubscribe(stream.subscription)
+				log.Error(err.Error())
+				return nil, c.JSON(500, "General server error")
+			}
+			for _, log := range logs {
+				event := models.TimeValueLogEvent{SystemCode: code, TimeValueLog: log}
+				stream.replay = append(stream.replay, event)
+				stream.replayed[newTimeValueStreamKey(event)]++
+			}
+		}
+		sort.SliceStable(stream.replay, func(i, j int) bool {
+			return stream.replay[i].Time.Before(stream.replay[j].Time)
+		})
+	}
+
+	return stream, nil
+}
+
+//Send the replayed and then the live logs until done is closed, sending fails or the subscription overflows
+func (s *timeValueStream) run(done <-chan struct{}, send func(models.TimeValueLogEvent) error, heartbeat func() error, overflow func() error) error {
+	for _, event := range s.replay {
+		if err := send(event); err != nil {
+			return err
+		}
+	}
+
+	ticker := time.NewTicker(timeValueStreamHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return nil
+		case <-ticker.C:
+			if err := heartbeat(); err != nil {
+				return err
+			}
+		case event, ok := <-s.subscription.Events():
+			if !ok {
+				if s.subscription.Overflowed() {
+					return overflow()
+				}
+				return nil
+			}
+			//logs written during the replay loading can be both replayed and published, older backfilled logs are sent
+			if key := newTimeValueStreamKey(event); s.replayed[key] > 0 {
+				s.replayed[key]--
+				continue
+			}
+			if err := send(event); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/mail"
+	"panda/apigateway/models"
+	"panda/apigateway/services"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+type UsersHandlers struct {
+	usersService services.IUsersService
+}
+
+//Users performing the maintenance, linked to the subjects of the JWT tokens
+type IUsersHandlers interface {
+	GetUsers() echo.HandlerFunc
+	GetUserByUsername() echo.HandlerFunc
+	GetCurrentUser() echo.HandlerFunc
+	CreateUser() echo.HandlerFunc
+	UpdateUser() echo.HandlerFunc
+	DeleteUser() echo.HandlerFunc
+}
+
+// NewUsersHandlers Users handlers constructor
+func NewUsersHandlers(usersSvc services.IUsersService) IUsersHandlers {
+	return &UsersHandlers{usersService: usersSvc}
+}
+
+func (h *UsersHandlers) GetUsers() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var active *bool
+		if activeParam := c.QueryParam("active"); activeParam != "" {
+			parsed, err := strconv.ParseBool(activeParam)
+			if err != nil {
+				return c.JSON(400, "Invalid active")
+			}
+			active = &parsed
+		}
+		result, err := h.usersService.GetUsers(active)
+		if err != nil {
+			log.Error(err.Error())
+			return c.JSON(500, "General server error")
+		}
+		for i := range result {
+			result[i] = privateUser(c, result[i])
+		}
+		return c.JSON(http.StatusOK, result)
+	}
+}
+
+func (h *UsersHandlers) GetUserByUsername() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		result, err := h.usersService.GetUserByUsername(c.Param("username"))
+		if err != nil {
+			if errors.Is(err, services.ErrUserNotFound) {
+				return c.JSON(404, "User not found")
+			}
+			log.Error(err.Error())
+			return c.JSON(500, "General server error")
+		}
+		return c.JSON(http.StatusOK, privateUser(c, result))
+	}
+}
+
+//User linked to the subject of the JWT token of the request
+func (h *UsersHandlers) GetCurrentUser() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		subject := tokenSubject(c)
+		if subject == "" {
+			return c.JSON(404, "No user is linked to the token")
+		}
+		result, err := h.usersService.GetUserBySubject(subject)
+		if err != nil {
+			if errors.Is(err, services.ErrUserNotFound) {
+				return c.JSON(404, "No user is linked to the token")
+			}
+			log.Error(err.Error())
+			return c.JSON(500, "General server error")
+		}
+		return c.JSON(http.StatusOK, result)
+	}
+}
+
+func (h *UsersHandlers) CreateUser() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if !tokenHasRole(c, usersAdminRole) {
+			return c.JSON(403, "Missing role "+usersAdminRole)
+		}
+		var user models.UserUpdate
+		err := c.Bind(&user)
+		if err != nil {
+			return c.JSON(400, "Invalid user data")
+		}
+		if user.Username == nil || strings.TrimSpace(*user.Username) == "" {
+			return c.JSON(400, "Invalid username")
+		}
+		if message, ok := validateUser(user); !ok {
+			return c.JSON(400, message)
+		}
+		result, err := h.usersService.CreateUser(user)
+		if err != nil {
+			if errors.Is(err, services.ErrUserConflict) {
+				return c.JSON(409, "User with this username already exists")
+			}
+			if errors.Is(err, services.ErrUserSubjectConflict) {
+				return c.JSON(409, "Token subject is already linked to another user")
+			}
+			log.Error(err.Error())
+			return c.JSON(500, "General server error")
+		}
+		return c.JSON(http.StatusOK, result)
+	}
+}
+
+//Without the users admin role the caller can update only the contact details of the User linked to its token
+func (h *UsersHandlers) UpdateUser() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var update models.UserUpdate
+		err := c.Bind(&update)
+		if err != nil {
+			return c.JSON(400, "Invalid user data")
+		}
+		if !tokenHasRole(c, usersAdminRole) {
+			if update.Username != nil || update.Active != nil || update.Subject != nil {
+				return c.JSON(403, "Missing role "+usersAdminRole)
+			}
+			ok, err := h.isCurrentUser(c, c.Param("username"))
+			if err != nil {
+				log.Error(err.Error())
+				return c.JSON(500, "General server error")
+			}
+			if !ok {
+				return c.JSON(403, "Missing role "+usersAdminRole)
+			}
+		}
+		if update.Username != nil && strings.TrimSpace(*update.Username) == "" {
+			return c.JSON(400, "Invalid username")
+		}
+		if message, ok := validateUser(update); !ok {
+			return c.JSON(400, message)
+		}
+		result, err := h.usersService.UpdateUser(c.Param("username"), update)
+		if err != nil {
+			if errors.Is(err, services.ErrUserNotFound) {
+				return c.JSON(404, "User not found")
+			}
+			if errors.Is(err, services.ErrUserConflict) {
+				return c.JSON(409, "User with this username already exists")
+			}
+			if errors.Is(err, services.ErrUserSubjectConflict) {
+				return c.JSON(409, "Token subject is already linked to another user")
+			}
+			log.Error(err.Error())
+			return c.JSON(500, "General server error")
+		}
+		return c.JSON(http.StatusOK, result)
+	}
+}
+
+//Users referenced by maintenance are deactivated instead of deleted
+func (h *UsersHandlers) DeleteUser() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if !tokenHasRole(c, usersAdminRole) {
+			return c.JSON(403, "Missing role "+usersAdminRole)
+		}
+		result, err := h.usersService.DeleteUser(c.Param("username"))
+		if err != nil {
+			if errors.Is(err, services.ErrUserNotFound) {
+				return c.JSON(404, "User not found")
+			}
+			log.Error(err.Error())
+			return c.JSON(500, "General server error")
+		}
+		return c.JSON(http.StatusOK, result)
+	}
+}
+
+//Whether the User is linked to the subject of the JWT token of the request
+func (h *UsersHandlers) isCurrentUser(c echo.Context, username string) (bool, error) {
+	subject := tokenSubject(c)
+	if subject == "" {
+		return false, nil
+	}
+	user, err := h.usersService.GetUserBySubject(subject)
+	if errors.Is(err, services.ErrUserNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return user.Username == username, nil
+}
+
+//Email and the linked token subject are shown only to the users admin and to the User linked to the token
+func privateUser(c echo.Context, user models.User) models.User {
+	if tokenHasRole(c, usersAdminRole) {
+		return user
+	}
+	if subject := tokenSubject(c); subject != "" && subject == user.Subject {
+		return user
+	}
+	user.Email = ""
+	user.Subject = ""
+	return user
+}
+
+//Validate the set fields of the new or updated User, empty email clears the email
+func validateUser(user models.UserUpdate) (string, bool) {
+	if user.Email != nil && *user.Email != "" {
+		if _, err := mail.ParseAddress(*user.Email); err != nil {
+			return "Invalid email", false
+		}
+	}
+	return "", true
+}
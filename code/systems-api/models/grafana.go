@@ -0,0 +1,53 @@
+package models
+
+import "time"
+
+//Models of the Grafana SimpleJSON datasource protocol
+
+type GrafanaTimeRange struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+type GrafanaSearchRequest struct {
+	Target string `json:"target"`
+}
+
+type GrafanaQueryTarget struct {
+	Target string `json:"target"`
+	RefID  string `json:"refId"`
+	Type   string `json:"type"`
+}
+
+type GrafanaQueryRequest struct {
+	Range         GrafanaTimeRange     `json:"range"`
+	MaxDataPoints int                  `json:"maxDataPoints"`
+	Targets       []GrafanaQueryTarget `json:"targets"`
+}
+
+//Datapoints are pairs of value and unix time in milliseconds
+type GrafanaTimeSeries struct {
+	Target     string       `json:"target"`
+	Datapoints [][2]float64 `json:"datapoints"`
+}
+
+type GrafanaAnnotation struct {
+	Name       string `json:"name"`
+	Datasource string `json:"datasource"`
+	IconColor  string `json:"iconColor"`
+	Enable     bool   `json:"enable"`
+	Query      string `json:"query"`
+}
+
+type GrafanaAnnotationRequest struct {
+	Range      GrafanaTimeRange  `json:"range"`
+	Annotation GrafanaAnnotation `json:"annotation"`
+}
+
+type GrafanaAnnotationEvent struct {
+	Annotation GrafanaAnnotation `json:"annotation"`
+	Time       int64             `json:"time"`
+	Title      string            `json:"title"`
+	Text       string            `json:"text"`
+	Tags       []string          `json:"tags"`
+}
@@ -3,24 +3,293 @@ package models
 import "time"
 
 type System struct {
-	Name             string `json:"name"`
-	Code             string `json:"code"`
+	Name             string   `json:"name"`
+	Code             string   `json:"code"`
+	Type             string   `json:"type"`
+	ParentSystemCode string   `json:"parentSystemCode"`
+	Ancestors        []System `json:"ancestors,omitempty"`
+}
+
+//System with its nested subsystems. ChildCount is the number of direct subsystems, also of those not included because of the depth.
+type SystemTreeNode struct {
+	Name       string            `json:"name"`
+	Code       string            `json:"code"`
+	ChildCount *int              `json:"childCount,omitempty"`
+	Subsystems []*SystemTreeNode `json:"subsystems"`
+}
+
+//Partial update of the System, only not nil fields are changed
+type SystemUpdate struct {
+	Name *string `json:"name"`
+	Code *string `json:"code"`
+	Type *string `json:"type"`
+}
+
+type SystemMoveRequest struct {
 	ParentSystemCode string `json:"parentSystemCode"`
 }
 
+//Record of the System move in the hierarchy, empty parent code means root
+type SystemMove struct {
+	When                 time.Time `json:"when"`
+	FromParentSystemCode string    `json:"fromParentSystemCode"`
+	ToParentSystemCode   string    `json:"toParentSystemCode"`
+	Username             string    `json:"username"`
+}
+
+//Result of the System delete, in dry run it is what would be deleted
+type SystemDeleteResult struct {
+	Mode                  string   `json:"mode"`
+	DryRun                bool     `json:"dryRun"`
+	DeletedSystems        []string `json:"deletedSystems"`
+	ReattachedSystems     []string `json:"reattachedSystems"`
+	NewParentSystemCode   string   `json:"newParentSystemCode"`
+	DeletedConfigurations int64    `json:"deletedConfigurations"`
+	DeletedTimeValueLogs  int64    `json:"deletedTimeValueLogs"`
+	DeletedMaintenance    int64    `json:"deletedMaintenance"`
+}
+
 type ResponseMessage struct {
 	Message string `json:"message"`
 }
 
+//Maintenance event of the System, type is inspection, repair or calibration, duration is in the Go duration format e.g. 1h30m
 type Maintenance struct {
-	SystemName string    `json:"systemName"`
-	When       time.Time `json:"when"`
-	Username   string    `json:"username"`
+	Id          string    `json:"id,omitempty"`
+	SystemName  string    `json:"systemName"`
+	SystemCode  string    `json:"systemCode"`
+	When        time.Time `json:"when"`
+	Username    string    `json:"username"`
+	Type        string    `json:"type,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Duration    string    `json:"duration,omitempty"`
+}
+
+//Filter of the maintenance listing, empty fields do not filter. With subtree the descendants of the System are included.
+//Limit 0 lists all maintenance.
+type MaintenanceFilter struct {
+	SystemCode string
+	Subtree    bool
+	From       *time.Time
+	To         *time.Time
+	Username   string
+	Type       string
+	Descending bool
+	Cursor     string
+	Limit      int
+}
+
+//Page of the maintenance listing, the next cursor is empty on the last page
+type MaintenancePage struct {
+	Items      []Maintenance `json:"items"`
+	TotalCount int64         `json:"totalCount"`
+	NextCursor string        `json:"nextCursor,omitempty"`
+}
+
+//Maintenance report of the subtree rolled up over all its Systems, rolled up per System type and of every System of the subtree
+type MaintenanceReport struct {
+	Period  string                  `json:"period"`
+	From    *time.Time              `json:"from,omitempty"`
+	To      *time.Time              `json:"to,omitempty"`
+	Subtree MaintenanceStatistics   `json:"subtree"`
+	Types   []MaintenanceStatistics `json:"types"`
+	Systems []MaintenanceStatistics `json:"systems"`
 }
 
+//Maintenance statistics of a System or of a System type, the mean time between maintenance is in days and it is computed from the intervals
+//between the consecutive maintenance of the same System
+type MaintenanceStatistics struct {
+	SystemCode                 string                   `json:"systemCode,omitempty"`
+	SystemName                 string                   `json:"systemName,omitempty"`
+	SystemType                 string                   `json:"systemType,omitempty"`
+	Count                      int                      `json:"count"`
+	CountsPerPeriod            []MaintenancePeriodCount `json:"countsPerPeriod"`
+	MeanDaysBetweenMaintenance *float64                 `json:"meanDaysBetweenMaintenance"`
+	LastMaintained             *time.Time               `json:"lastMaintained"`
+	TopTechnicians             []TechnicianCount        `json:"topTechnicians"`
+}
+
+type MaintenancePeriodCount struct {
+	Period string `json:"period"`
+	Count  int    `json:"count"`
+}
+
+type TechnicianCount struct {
+	Username string `json:"username"`
+	Count    int    `json:"count"`
+}
+
+//New maintenance event, when defaults to now and username to the subject of the JWT token
+type MaintenanceRequest struct {
+	When        *time.Time `json:"when"`
+	Username    string     `json:"username"`
+	Type        string     `json:"type"`
+	Description string     `json:"description"`
+	Duration    string     `json:"duration"`
+}
+
+//Preventive maintenance plan of the System. Frequency is days (every interval days), monthly (every interval months)
+//or rrule (iCalendar RRULE with start as DTSTART). The next due date follows the last maintenance event of the plan type,
+//or of any type if the plan has no type. Without any maintenance event the first due date is the start.
+//Username is the optional technician responsible for the plan.
+type MaintenancePlan struct {
+	Id             string     `json:"id"`
+	SystemCode     string     `json:"systemCode"`
+	SystemName     string     `json:"systemName"`
+	Name           string     `json:"name"`
+	Type           string     `json:"type,omitempty"`
+	Description    string     `json:"description,omitempty"`
+	Username       string     `json:"username,omitempty"`
+	Frequency      string     `json:"frequency"`
+	Interval       int        `json:"interval,omitempty"`
+	RRule          string     `json:"rrule,omitempty"`
+	Start          time.Time  `json:"start"`
+	LastMaintained *time.Time `json:"lastMaintained"`
+	NextDue        *time.Time `json:"nextDue"`
+	Overdue        bool       `json:"overdue"`
+}
+
+//Value is always the string form, type, typed value and unit are added if the key has a schema for the System type.
+//Values of secret entries are stored encrypted and masked in reads.
 type Configuration struct {
-	Key   string `json:"key"`
-	Value string `json:"value"`
+	Key        string      `json:"key"`
+	Value      string      `json:"value"`
+	Type       string      `json:"type,omitempty"`
+	TypedValue interface{} `json:"typedValue,omitempty"`
+	Unit       string      `json:"unit,omitempty"`
+	Secret     bool        `json:"secret,omitempty"`
+}
+
+//Schema of one configuration key for a System type. Type is string, int, float, bool, enum, ip or duration.
+//Min and max are the range of int, float and duration (in seconds) values, values are the allowed enum values.
+type ConfigurationKeySchema struct {
+	Key         string   `json:"key"`
+	Type        string   `json:"type"`
+	Min         *float64 `json:"min,omitempty"`
+	Max         *float64 `json:"max,omitempty"`
+	Values      []string `json:"values,omitempty"`
+	Unit        string   `json:"unit,omitempty"`
+	Description string   `json:"description,omitempty"`
+}
+
+//Configuration entry valid for the System, possibly inherited from the nearest ancestor System having the key
+type EffectiveConfiguration struct {
+	Key              string `json:"key"`
+	Value            string `json:"value"`
+	SourceSystemCode string `json:"sourceSystemCode"`
+	Inherited        bool   `json:"inherited"`
+	Secret           bool   `json:"secret,omitempty"`
+}
+
+type ConfigurationDifference struct {
+	Key        string `json:"key"`
+	LeftValue  string `json:"leftValue"`
+	RightValue string `json:"rightValue"`
+	//secret values are never compared, it is unknown whether they differ
+	Secret bool `json:"secret,omitempty"`
+}
+
+//Configuration comparison of two Systems, path is the relative path of the Systems in the compared subtrees
+type ConfigurationComparison struct {
+	Path            string                    `json:"path"`
+	LeftSystemCode  string                    `json:"leftSystemCode"`
+	RightSystemCode string                    `json:"rightSystemCode"`
+	OnlyLeft        []Configuration           `json:"onlyLeft"`
+	OnlyRight       []Configuration           `json:"onlyRight"`
+	Different       []ConfigurationDifference `json:"different"`
+}
+
+//Configuration comparison of two subtrees, Systems are matched by the path of their names relative to the subtree root
+type SubtreeConfigurationComparison struct {
+	Comparisons      []ConfigurationComparison `json:"comparisons"`
+	OnlyLeftSystems  []string                  `json:"onlyLeftSystems"`
+	OnlyRightSystems []string                  `json:"onlyRightSystems"`
+}
+
+//Bulk configuration change of the Systems matched by all given selectors: the subtree including its root, the code pattern
+//with * and ? wildcards, the search text in name or code and the System type. Keys are set first, then removed.
+type BulkConfigurationRequest struct {
+	SubtreeSystemCode string          `json:"subtreeSystemCode,omitempty"`
+	CodePattern       string          `json:"codePattern,omitempty"`
+	SearchText        string          `json:"searchText,omitempty"`
+	SystemType        string          `json:"systemType,omitempty"`
+	Set               []Configuration `json:"set"`
+	Remove            []string        `json:"remove"`
+}
+
+//Result of the bulk configuration change, nothing is applied in dry run or when the change is not valid for any of the Systems
+type BulkConfigurationResult struct {
+	DryRun  bool                            `json:"dryRun"`
+	Applied bool                            `json:"applied"`
+	Systems []BulkConfigurationSystemResult `json:"systems"`
+}
+
+type BulkConfigurationSystemResult struct {
+	SystemCode string                `json:"systemCode"`
+	SystemName string                `json:"systemName"`
+	Changes    []ConfigurationChange `json:"changes"`
+	Errors     []string              `json:"errors,omitempty"`
+}
+
+//Named snapshot of the configuration of all Systems in the subtree of the System
+type ConfigurationSnapshot struct {
+	Name        string    `json:"name"`
+	SystemCode  string    `json:"systemCode"`
+	When        time.Time `json:"when"`
+	Username    string    `json:"username"`
+	SystemCount int       `json:"systemCount"`
+}
+
+type ConfigurationSnapshotRequest struct {
+	Name string `json:"name"`
+}
+
+//Configuration changes of one System of the subtree
+type SystemConfigurationChanges struct {
+	SystemCode string                `json:"systemCode"`
+	Changes    []ConfigurationChange `json:"changes"`
+}
+
+//Comparison of the snapshot with another snapshot, or with the current configuration if to is empty.
+//Only Systems with changes are listed, Systems present in only one of the states are reported by code.
+type ConfigurationSnapshotComparison struct {
+	From            string                       `json:"from"`
+	To              string                       `json:"to"`
+	Systems         []SystemConfigurationChanges `json:"systems"`
+	OnlyFromSystems []string                     `json:"onlyFromSystems"`
+	OnlyToSystems   []string                     `json:"onlyToSystems"`
+}
+
+//Result of the snapshot restore, in dry run it is what would be changed. Missing are the snapshot Systems no longer in the subtree.
+type ConfigurationSnapshotRestoreResult struct {
+	Name           string                       `json:"name"`
+	DryRun         bool                         `json:"dryRun"`
+	Systems        []SystemConfigurationChanges `json:"systems"`
+	MissingSystems []string                     `json:"missingSystems"`
+}
+
+//Audited reveal of the secret configuration value
+type SecretAccess struct {
+	SystemCode string    `json:"systemCode"`
+	Key        string    `json:"key"`
+	Username   string    `json:"username"`
+	When       time.Time `json:"when"`
+}
+
+//Change of one configuration key, action is created, updated, unchanged or deleted
+type ConfigurationChange struct {
+	Key      string  `json:"key"`
+	OldValue *string `json:"oldValue"`
+	NewValue *string `json:"newValue"`
+	Action   string  `json:"action"`
+}
+
+//Immutable record of the configuration changes of one System
+type ConfigurationRevision struct {
+	Revision int64                 `json:"revision"`
+	When     time.Time             `json:"when"`
+	Username string                `json:"username"`
+	Changes  []ConfigurationChange `json:"changes"`
 }
 
 type TimeValueLog struct {
@@ -28,3 +297,33 @@ type TimeValueLog struct {
 	Value float64   `json:"value"`
 	Unit  string    `json:"unit"`
 }
+
+type TimeValueLogEvent struct {
+	SystemCode string `json:"systemCode"`
+	TimeValueLog
+}
+
+//Message of the time-value logs WebSocket stream, type is log, heartbeat or overflow
+type TimeValueStreamMessage struct {
+	Type string             `json:"type"`
+	Log  *TimeValueLogEvent `json:"log,omitempty"`
+}
+
+//Aggregation of time-value logs. Function is one of min, max, avg, count, first, last with the Bucket size,
+//or lttb (Largest-Triangle-Three-Buckets visual downsampling) with the target number of Points.
+type TimeValueLogAggregation struct {
+	Function string
+	Bucket   time.Duration
+	Points   int
+}
+
+type TimeValueLogIngestResult struct {
+	Accepted int                    `json:"accepted"`
+	Rejected []RejectedTimeValueLog `json:"rejected"`
+}
+
+type RejectedTimeValueLog struct {
+	Index  int          `json:"index"`
+	Log    TimeValueLog `json:"log"`
+	Reason string       `json:"reason"`
+}
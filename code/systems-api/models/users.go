@@ -0,0 +1,21 @@
+package models
+
+//User performing the maintenance. Subject is the subject of the JWT token linked to the User.
+type User struct {
+	Username    string `json:"username"`
+	DisplayName string `json:"displayName"`
+	Email       string `json:"email,omitempty"`
+	Team        string `json:"team"`
+	Active      bool   `json:"active"`
+	Subject     string `json:"subject,omitempty"`
+}
+
+//New User or partial update of the User, only not nil fields are set
+type UserUpdate struct {
+	Username    *string `json:"username"`
+	DisplayName *string `json:"displayName"`
+	Email       *string `json:"email"`
+	Team        *string `json:"team"`
+	Active      *bool   `json:"active"`
+	Subject     *string `json:"subject"`
+}
@@ -0,0 +1,16 @@
+package routes
+
+import (
+	"panda/apigateway/handlers"
+
+	"github.com/labstack/echo/v4"
+)
+
+//Grafana SimpleJSON datasource routes, the datasource URL is the group URL
+func MapGrafanaRoutes(g *echo.Group, h handlers.IGrafanaHandlers) {
+	g.GET("", h.TestConnection())
+	g.GET("/", h.TestConnection())
+	g.POST("/search", h.Search())
+	g.POST("/query", h.Query())
+	g.POST("/annotations", h.Annotations())
+}
@@ -10,15 +10,46 @@ func MapSystemsRoutes(g *echo.Group, h handlers.ISystemsHandlers, jwtMiddleware
 	// Create new system route
 	g.POST("/system", h.CreateNewSystem(), jwtMiddleware)
 	g.GET("/systems", h.GetSystemsByNameOrCode())
+	g.GET("/systems/tree", h.GetSystemsForest())
 	g.GET("/system/:systemCode", h.GetSystemByCode())
+	g.PUT("/system/:systemCode", h.UpdateSystem(), jwtMiddleware)
+	g.PATCH("/system/:systemCode", h.PatchSystem(), jwtMiddleware)
 	g.DELETE("/system/:systemCode", h.DeleteSystemByCode(), jwtMiddleware)
+	g.POST("/system/:systemCode/move", h.MoveSystem(), jwtMiddleware)
+	g.GET("/system/:systemCode/moves", h.GetSystemMoveHistory())
+	g.GET("/system/:systemCode/tree", h.GetSystemTree())
+	g.GET("/system/:systemCode/ancestors", h.GetSystemAncestors())
 
+	g.GET("/system/configuration/compare", h.CompareSystemConfigurations())
+	g.POST("/system/configuration/bulk", h.ApplyBulkConfiguration(), jwtMiddleware)
 	g.GET("/system/configuration/:systemCode", h.GetSystemConfigurationBySystemCode())
+	g.PUT("/system/configuration/:systemCode", h.UpsertSystemConfiguration(), jwtMiddleware)
 	g.DELETE("/system/configuration/:systemCode", h.DeleteConfigurationByKeyAndSystemCode(), jwtMiddleware)
+	g.GET("/system/configuration/:systemCode/effective", h.GetSystemEffectiveConfiguration())
+	g.GET("/system/configuration/:systemCode/revisions", h.GetSystemConfigurationRevisions())
+	g.GET("/system/configuration/:systemCode/revisions/diff", h.DiffSystemConfigurationRevisions())
+	g.POST("/system/configuration/:systemCode/revisions/:revision/rollback", h.RollbackSystemConfiguration(), jwtMiddleware)
+	g.POST("/system/configuration/:systemCode/secrets/:key/reveal", h.RevealSystemConfigurationSecret(), jwtMiddleware)
+	g.GET("/system/configuration/:systemCode/secret-accesses", h.GetConfigurationSecretAccesses(), jwtMiddleware)
+	g.GET("/system/configuration/:systemCode/snapshots", h.GetConfigurationSnapshots())
+	g.POST("/system/configuration/:systemCode/snapshots", h.CreateConfigurationSnapshot(), jwtMiddleware)
+	g.GET("/system/configuration/:systemCode/snapshots/compare", h.CompareConfigurationSnapshots())
+	g.POST("/system/configuration/:systemCode/snapshots/:name/restore", h.RestoreConfigurationSnapshot(), jwtMiddleware)
+
+	g.GET("/configuration-schema/:systemType", h.GetConfigurationSchema())
+	g.PUT("/configuration-schema/:systemType", h.SetConfigurationSchema(), jwtMiddleware)
 
 	g.GET("/system/maintenance", h.GetSystemMaintenance())
+	g.POST("/system/maintenance/:systemCode", h.CreateSystemMaintenance(), jwtMiddleware)
+	g.GET("/system/maintenance/due", h.GetDueMaintenance())
+	g.GET("/system/maintenance/calendar.ics", h.GetMaintenanceCalendar())
+	g.GET("/system/maintenance/statistics", h.GetMaintenanceReport())
+	g.GET("/system/maintenance/:systemCode/plans", h.GetMaintenancePlans())
+	g.POST("/system/maintenance/:systemCode/plans", h.CreateMaintenancePlan(), jwtMiddleware)
+	g.DELETE("/system/maintenance/:systemCode/plans/:planId", h.DeleteMaintenancePlan(), jwtMiddleware)
 
 	g.GET("/system/time-value-logs/:systemCode", h.GetSystemTimeValueLogs())
+	g.POST("/system/time-value-logs/:systemCode", h.CreateSystemTimeValueLogs(), jwtMiddleware)
 
 	g.POST("/database/deleteAndInitNewData", h.RecreateDatabaseData(), jwtMiddleware)
 }
@@ -0,0 +1,12 @@
+package routes
+
+import (
+	"panda/apigateway/handlers"
+
+	"github.com/labstack/echo/v4"
+)
+
+func MapTimeValueStreamRoutes(g *echo.Group, h handlers.ITimeValueStreamHandlers) {
+	g.GET("/system/time-value-logs/:systemCode/stream", h.StreamSystemTimeValueLogsSSE())
+	g.GET("/system/time-value-logs/:systemCode/ws", h.StreamSystemTimeValueLogsWebSocket())
+}
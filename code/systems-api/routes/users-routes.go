@@ -0,0 +1,16 @@
+package routes
+
+import (
+	"panda/apigateway/handlers"
+
+	"github.com/labstack/echo/v4"
+)
+
+func MapUsersRoutes(g *echo.Group, h handlers.IUsersHandlers, jwtMiddleware echo.MiddlewareFunc) {
+	g.GET("/users", h.GetUsers(), jwtMiddleware)
+	g.POST("/user", h.CreateUser(), jwtMiddleware)
+	g.GET("/user/me", h.GetCurrentUser(), jwtMiddleware)
+	g.GET("/user/:username", h.GetUserByUsername(), jwtMiddleware)
+	g.PATCH("/user/:username", h.UpdateUser(), jwtMiddleware)
+	g.DELETE("/user/:username", h.DeleteUser(), jwtMiddleware)
+}
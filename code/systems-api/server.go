@@ -74,9 +74,37 @@ func main() {
 
 	//Group of routes for Systems
 	systemGroup := e.Group("v1")
-	systemsService := services.NewSystemsService(neo4jDriver)
-	systemsHandlers := handlers.NewSystemsHandlers(systemsService)
+	timeValueBroadcaster := services.NewTimeValueBroadcaster()
+	//server-side key of the secret configuration values, it has to be set in production
+	configSecretKey := os.Getenv("CONFIG_SECRET_KEY")
+	if configSecretKey == "" && !isProduction {
+		configSecretKey = "openapi-tutorial-config-secrets"
+	}
+	secretCipher, err := services.NewConfigurationSecretCipher(configSecretKey)
+	if err != nil {
+		panic(err)
+	}
+	systemsService := services.NewSystemsService(neo4jDriver, timeValueBroadcaster, secretCipher)
+	//the listings stay read-only, the old data are migrated here once
+	if err = systemsService.MigrateDatabaseData(); err != nil {
+		e.Logger.Error(err)
+	}
+	usersService := services.NewUsersService(neo4jDriver)
+	systemsHandlers := handlers.NewSystemsHandlers(systemsService, usersService)
 	routes.MapSystemsRoutes(systemGroup, systemsHandlers, jwtMiddleware)
 
+	//Users performing the maintenance
+	usersHandlers := handlers.NewUsersHandlers(usersService)
+	routes.MapUsersRoutes(systemGroup, usersHandlers, jwtMiddleware)
+
+	//Live streams of the time-value logs
+	timeValueStreamHandlers := handlers.NewTimeValueStreamHandlers(systemsService, timeValueBroadcaster)
+	routes.MapTimeValueStreamRoutes(systemGroup, timeValueStreamHandlers)
+
+	//Group of routes for Grafana SimpleJSON datasource
+	grafanaGroup := e.Group("grafana")
+	grafanaHandlers := handlers.NewGrafanaHandlers(systemsService)
+	routes.MapGrafanaRoutes(grafanaGroup, grafanaHandlers)
+
 	e.Logger.Fatal(e.Start(port))
 }
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"panda/apigateway/models"
+	"regexp"
+	"strings"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+//Read the Systems matched by all selectors of the bulk configuration request ordered by code
+func readBulkConfigurationTargets(tx neo4j.Transaction, request models.BulkConfigurationRequest) ([]models.System, error) {
+	params := map[string]interface{}{
+		"subtreeSystemCode": nil,
+		"codePattern":       nil,
+		"searchText":        nil,
+		"systemType":        nil,
+	}
+	if request.SubtreeSystemCode != "" {
+		reader, err := tx.Run(`MATCH (root:System{code: $systemCode}) RETURN root.code`, map[string]interface{}{
+			"systemCode": request.SubtreeSystemCode,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if !reader.Next() {
+			if err = reader.Err(); err != nil {
+				return nil, err
+			}
+			return nil, ErrSystemNotFound
+		}
+		params["subtreeSystemCode"] = request.SubtreeSystemCode
+	}
+	if request.CodePattern != "" {
+		params["codePattern"] = codePatternRegex(request.CodePattern)
+	}
+	if request.SearchText != "" {
+		params["searchText"] = strings.ToLower(request.SearchText)
+	}
+	if request.SystemType != "" {
+		params["systemType"] = request.SystemType
+	}
+
+	reader, err := tx.Run(`MATCH (s:System)
+	WHERE ($subtreeSystemCode IS NULL OR exists((:System{code: $subtreeSystemCode})-[:HAS_SUBSYSTEM*0..]->(s)))
+	AND ($codePattern IS NULL OR s.code =~ $codePattern)
+	AND ($searchText IS NULL OR toLower(s.name) CONTAINS $searchText OR toLower(s.code) CONTAINS $searchText)
+	AND ($systemType IS NULL OR s.type = $systemType)
+	RETURN s.code, s.name ORDER BY s.code`, params)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]models.System, 0)
+	for reader.Next() {
+		list = append(list, models.System{Code: reader.Record().Values[0].(string), Name: reader.Record().Values[1].(string)})
+	}
+	if err = reader.Err(); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+//Regular expression matching the whole System code by the pattern with * (any characters) and ? (one character) wildcards
+func codePatternRegex(pattern string) string {
+	var builder strings.Builder
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			builder.WriteString(".*")
+		case '?':
+			builder.WriteString(".")
+		default:
+			builder.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	return builder.String()
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"fmt"
+	"panda/apigateway/models"
+	"sort"
+)
+
+//Compare the configuration of two Systems key by key, all lists are ordered by key. Values of the secret entries are masked
+//and never compared, secret keys on both sides are listed as different with unknown difference.
+func compareConfigurations(left []models.Configuration, right []models.Configuration) models.ConfigurationComparison {
+	comparison := models.ConfigurationComparison{
+		OnlyLeft:  make([]models.Configuration, 0),
+		OnlyRight: make([]models.Configuration, 0),
+		Different: make([]models.ConfigurationDifference, 0),
+	}
+
+	rightValues := make(map[string]string, len(right))
+	rightSecrets := make(map[string]bool)
+	for _, entry := range right {
+		rightValues[entry.Key] = entry.Value
+		rightSecrets[entry.Key] = entry.Secret || isSecretConfigurationValue(entry.Value)
+	}
+	leftValues := make(map[string]string, len(left))
+	for _, entry := range left {
+		leftValues[entry.Key] = entry.Value
+		rightValue, ok := rightValues[entry.Key]
+		if !ok {
+			comparison.OnlyLeft = append(comparison.OnlyLeft, entry)
+		} else if entry.Secret || isSecretConfigurationValue(entry.Value) || rightSecrets[entry.Key] {
+			comparison.Different = append(comparison.Different, models.ConfigurationDifference{
+				Key:        entry.Key,
+				LeftValue:  MaskedConfigurationValue,
+				RightValue: MaskedConfigurationValue,
+				Secret:     true,
+			})
+		} else if rightValue != entry.Value {
+			comparison.Different = append(comparison.Different, models.ConfigurationDifference{Key: entry.Key, LeftValue: entry.Value, RightValue: rightValue})
+		}
+	}
+	for _, entry := range right {
+		if _, ok := leftValues[entry.Key]; !ok {
+			comparison.OnlyRight = append(comparison.OnlyRight, entry)
+		}
+	}
+
+	maskConfiguration(comparison.OnlyLeft)
+	maskConfiguration(comparison.OnlyRight)
+	sort.Slice(comparison.OnlyLeft, func(i, j int) bool { return comparison.OnlyLeft[i].Key < comparison.OnlyLeft[j].Key })
+	sort.Slice(comparison.OnlyRight, func(i, j int) bool { return comparison.OnlyRight[i].Key < comparison.OnlyRight[j].Key })
+	sort.Slice(comparison.Different, func(i, j int) bool { return comparison.Different[i].Key < comparison.Different[j].Key })
+
+	return comparison
+}
+
+//Codes of the Systems in the subtree by their path of names relative to the subtree root, the root itself has empty path.
+//Sibling Systems with the same name cannot be matched by the path, they are refused instead of leaving one out.
+func relativeSystemPaths(node *models.SystemTreeNode, path string, paths map[string]string) error {
+	if code, ok := paths[path]; ok {
+		return fmt.Errorf("%w: %s (%s and %s)", ErrSystemPathConflict, path, code, node.Code)
+	}
+	paths[path] = node.Code
+	for _, subsystem := range node.Subsystems {
+		subsystemPath := subsystem.Name
+		if path != "" {
+			subsystemPath = path + "/" + subsystem.Name
+		}
+		if err := relativeSystemPaths(subsystem, subsystemPath, paths); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package services
+
+import (
+	"encoding/json"
+	"panda/apigateway/models"
+	"sort"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+//Write lock of the System serializes the concurrent configuration writes, so the revision numbers are unique and
+//the recorded old values are not stale. Must be the first statement of the transaction, before the configuration is read.
+func lockSystemConfiguration(tx neo4j.Transaction, systemCode string) error {
+	_, err := tx.Run(`MATCH (s:System{code: $systemCode}) 
+	SET s.configurationLock = true 
+	REMOVE s.configurationLock`, map[string]interface{}{
+		"systemCode": systemCode,
+	})
+	return err
+}
+
+//Read the current configuration of the System as key-value map
+func readSystemConfiguration(tx neo4j.Transaction, systemCode string) (map[string]string, error) {
+	reader, err := tx.Run(`MATCH (s:System{code: $systemCode}) 
+	OPTIONAL MATCH (s)-[:HAS]->(c:Config) 
+	RETURN c.key, c.value`, map[string]interface{}{
+		"systemCode": systemCode,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	configuration := make(map[string]string)
+	found := false
+	for reader.Next() {
+		found = true
+		if key, ok := reader.Record().Values[0].(string); ok {
+			configuration[key] = reader.Record().Values[1].(string)
+		}
+	}
+	if err = reader.Err(); err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrSystemNotFound
+	}
+
+	return configuration, nil
+}
+
+//Read the configuration revisions of the System ordered from the oldest one
+func readSystemConfigurationRevisions(tx neo4j.Transaction, systemCode string) ([]models.ConfigurationRevision, error) {
+	reader, err := tx.Run(`MATCH (s:System{code: $systemCode})-[:HAS_REVISION]->(r:ConfigRevision) 
+	RETURN r.revision, r.date, r.username, r.changes order by r.revision`, map[string]interface{}{
+		"systemCode": systemCode,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]models.ConfigurationRevision, 0)
+	for reader.Next() {
+		revision := models.ConfigurationRevision{Revision: reader.Record().Values[0].(int64), When: reader.Record().Values[1].(time.Time), Username: reader.Record().Values[2].(string)}
+		if err = json.Unmarshal([]byte(reader.Record().Values[3].(string)), &revision.Changes); err != nil {
+			return nil, err
+		}
+		list = append(list, revision)
+	}
+	if err = reader.Err(); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+//Write the configuration changes of the System and record them as a new immutable revision. Unchanged entries are skipped.
+//The changes are validated by validateSystemConfigurationChanges before and the System is locked by lockSystemConfiguration
+//before its configuration was read.
+func writeSystemConfigurationChanges(tx neo4j.Transaction, systemCode string, changes []models.ConfigurationChange, username string) error {
+	recorded := make([]models.ConfigurationChange, 0, len(changes))
+	written := make([]interface{}, 0, len(changes))
+	deleted := make([]string, 0)
+	for _, change := range changes {
+		switch change.Action {
+		case "created", "updated":
+			written = append(written, map[string]interface{}{"key": change.Key, "value": *change.NewValue})
+		case "deleted":
+			deleted = append(deleted, change.Key)
+		default:
+			continue
+		}
+		recorded = append(recorded, change)
+	}
+	if len(recorded) == 0 {
+		return nil
+	}
+
+	var err error
+	if len(written) > 0 {
+		//duplicate Config nodes of the key are merged into one
+		_, err = tx.Run(`MATCH (s:System{code: $systemCode}) 
+		UNWIND $entries AS entry 
+		OPTIONAL MATCH (s)-[:HAS]->(c:Config{key: entry.key}) 
+		WITH s, entry, collect(c) AS configs 
+		FOREACH (duplicate IN configs[1..] | DETACH DELETE duplicate) 
+		FOREACH (config IN configs[0..1] | SET config.value = entry.value) 
+		FOREACH (x IN CASE WHEN size(configs) = 0 THEN [1] ELSE [] END | CREATE (s)-[:HAS]->(:Config{key: entry.key, value: entry.value}))`, map[string]interface{}{
+			"systemCode": systemCode,
+			"entries":    written,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(deleted) > 0 {
+		_, err = tx.Run(`MATCH (s:System{code: $systemCode})-[:HAS]->(c:Config) WHERE c.key IN $keys 
+		DETACH DELETE c`, map[string]interface{}{
+			"systemCode": systemCode,
+			"keys":       deleted,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	//changes are stored as JSON, the revision is never modified
+	recordedJSON, err := json.Marshal(recorded)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Run(`MATCH (s:System{code: $systemCode}) 
+	OPTIONAL MATCH (s)-[:HAS_REVISION]->(r:ConfigRevision) 
+	WITH s, coalesce(max(r.revision), 0) + 1 AS revision 
+	CREATE (s)-[:HAS_REVISION]->(:ConfigRevision{revision: revision, date: datetime(), username: $username, changes: $changes})`, map[string]interface{}{
+		"systemCode": systemCode,
+		"username":   username,
+		"changes":    string(recordedJSON),
+	})
+	return err
+}
+
+//Configuration after the revision, computed by undoing the newer revisions from the current configuration.
+//It works also for the configuration created before the revisions were recorded.
+func configurationAtRevision(current map[string]string, revisions []models.ConfigurationRevision, revision int64) (map[string]string, error) {
+	if revision < 0 || (revision > 0 && (len(revisions) == 0 || revision > revisions[len(revisions)-1].Revision)) {
+		return nil, ErrConfigurationRevisionNotFound
+	}
+	return undoConfigurationRevisions(current, revisions, func(r models.ConfigurationRevision) bool {
+		return r.Revision > revision
+	}), nil
+}
+
+//Configuration at the time, computed by undoing the newer revisions from the current configuration
+func configurationAtTime(current map[string]string, revisions []models.ConfigurationRevision, at time.Time) map[string]string {
+	return undoConfigurationRevisions(current, revisions, func(r models.ConfigurationRevision) bool {
+		return r.When.After(at)
+	})
+}
+
+func undoConfigurationRevisions(current map[string]string, revisions []models.ConfigurationRevision, undo func(models.ConfigurationRevision) bool) map[string]string {
+	configuration := make(map[string]string, len(current))
+	for key, value := range current {
+		configuration[key] = value
+	}
+	for i := len(revisions) - 1; i >= 0 && undo(revisions[i]); i-- {
+		for _, change := range revisions[i].Changes {
+			if change.OldValue == nil {
+				delete(configuration, change.Key)
+			} else {
+				configuration[change.Key] = *change.OldValue
+			}
+		}
+	}
+	return configuration
+}
+
+//Changes turning the from configuration to the to configuration ordered by key, unchanged keys are not included.
+//Secret values are compared as stored, so the same secret written again is a change (the ciphertexts differ by the nonce).
+func diffConfigurations(from map[string]string, to map[string]string) []models.ConfigurationChange {
+	changes := make([]models.ConfigurationChange, 0)
+	for key, oldValue := range from {
+		oldValue := oldValue
+		if newValue, ok := to[key]; !ok {
+			changes = append(changes, models.ConfigurationChange{Key: key, OldValue: &oldValue, Action: "deleted"})
+		} else if oldValue != newValue {
+			changes = append(changes, models.ConfigurationChange{Key: key, OldValue: &oldValue, NewValue: &newValue, Action: "updated"})
+		}
+	}
+	for key, newValue := range to {
+		newValue := newValue
+		if _, ok := from[key]; !ok {
+			changes = append(changes, models.ConfigurationChange{Key: key, NewValue: &newValue, Action: "created"})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+	return changes
+}
+
+//Configuration list ordered by key
+func configurationList(configuration map[string]string) []models.Configuration {
+	list := make([]models.Configuration, 0, len(configuration))
+	for key, value := range configuration {
+		list = append(list, models.Configuration{Key: key, Value: value})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Key < list[j].Key
+	})
+	return list
+}
@@ -0,0 +1,197 @@
+package services
+
+import (
+	"fmt"
+	"net"
+	"panda/apigateway/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+//Invalid configuration values of the write, with the reason for every key
+type ConfigurationValidationError struct {
+	Errors []string
+}
+
+func (e *ConfigurationValidationError) Error() string {
+	return "Invalid configuration values: " + strings.Join(e.Errors, "; ")
+}
+
+var configurationValueTypes = map[string]bool{"string": true, "int": true, "float": true, "bool": true, "enum": true, "ip": true, "duration": true}
+
+//Check the schema itself, so the values can be validated by it
+func validateConfigurationSchema(keys []models.ConfigurationKeySchema) error {
+	errs := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		switch {
+		case key.Key == "":
+			errs = append(errs, "missing key")
+		case seen[key.Key]:
+			errs = append(errs, key.Key+": duplicate key")
+		case !configurationValueTypes[key.Type]:
+			errs = append(errs, key.Key+": unknown type "+key.Type)
+		case key.Type == "enum" && len(key.Values) == 0:
+			errs = append(errs, key.Key+": enum without values")
+		case key.Min != nil && key.Max != nil && *key.Min > *key.Max:
+			errs = append(errs, key.Key+": min is greater than max")
+		}
+		seen[key.Key] = true
+	}
+	if len(errs) > 0 {
+		return &ConfigurationValidationError{Errors: errs}
+	}
+	return nil
+}
+
+//Read the configuration schema of the type of the System by key, empty if the System has no type or its type has no schema
+func readSystemConfigurationSchema(tx neo4j.Transaction, systemCode string) (map[string]models.ConfigurationKeySchema, error) {
+	reader, err := tx.Run(`MATCH (s:System{code: $systemCode}) 
+	MATCH (schema:ConfigSchema{systemType: s.type}) 
+	RETURN schema.key, schema.type, schema.min, schema.max, schema.values, schema.unit, schema.description`, map[string]interface{}{
+		"systemCode": systemCode,
+	})
+	if err != nil {
+		return nil, err
+	}
+	schemas := make(map[string]models.ConfigurationKeySchema)
+	for reader.Next() {
+		schema := configurationKeySchemaFromRecord(reader.Record())
+		schemas[schema.Key] = schema
+	}
+	return schemas, reader.Err()
+}
+
+func configurationKeySchemaFromRecord(record *neo4j.Record) models.ConfigurationKeySchema {
+	schema := models.ConfigurationKeySchema{Key: record.Values[0].(string), Type: record.Values[1].(string)}
+	if min, ok := record.Values[2].(float64); ok {
+		schema.Min = &min
+	}
+	if max, ok := record.Values[3].(float64); ok {
+		schema.Max = &max
+	}
+	if values, ok := record.Values[4].([]interface{}); ok {
+		for _, value := range values {
+			schema.Values = append(schema.Values, value.(string))
+		}
+	}
+	schema.Unit, _ = record.Values[5].(string)
+	schema.Description, _ = record.Values[6].(string)
+	return schema
+}
+
+//Validate the changes of the System configuration by the schema of its type, once before they are written
+func validateSystemConfigurationChanges(tx neo4j.Transaction, systemCode string, changes []models.ConfigurationChange, secretCipher *ConfigurationSecretCipher) error {
+	schemas, err := readSystemConfigurationSchema(tx, systemCode)
+	if err != nil {
+		return err
+	}
+	return validateConfigurationChanges(schemas, changes, secretCipher)
+}
+
+//Validate the created and updated values by the schema of the System type, keys without schema are plain strings.
+//Encrypted secret values (e.g. restored from a revision or snapshot) are validated decrypted, the error does not show them.
+func validateConfigurationChanges(schemas map[string]models.ConfigurationKeySchema, changes []models.ConfigurationChange, secretCipher *ConfigurationSecretCipher) error {
+	errs := make([]string, 0)
+	for _, change := range changes {
+		if change.NewValue == nil || change.Action == "unchanged" {
+			continue
+		}
+		schema, ok := schemas[change.Key]
+		if !ok {
+			continue
+		}
+		if isSecretConfigurationValue(*change.NewValue) {
+			value, err := secretCipher.decrypt(*change.NewValue)
+			if err != nil {
+				return err
+			}
+			if _, err := parseConfigurationValue(schema, value); err != nil {
+				errs = append(errs, change.Key+": secret value is not a valid "+schema.Type)
+			}
+			continue
+		}
+		if _, err := parseConfigurationValue(schema, *change.NewValue); err != nil {
+			errs = append(errs, change.Key+": "+err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return &ConfigurationValidationError{Errors: errs}
+	}
+	return nil
+}
+
+//Parse the string value to the type of the schema and check its range or allowed values
+func parseConfigurationValue(schema models.ConfigurationKeySchema, value string) (interface{}, error) {
+	var number float64
+	var typed interface{}
+
+	switch schema.Type {
+	case "int":
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an integer", value)
+		}
+		number, typed = float64(parsed), parsed
+	case "float":
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", value)
+		}
+		number, typed = parsed, parsed
+	case "duration":
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a duration", value)
+		}
+		number, typed = parsed.Seconds(), parsed.String()
+	case "bool":
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a boolean", value)
+		}
+		return parsed, nil
+	case "ip":
+		if net.ParseIP(value) == nil {
+			return nil, fmt.Errorf("%q is not an IP address", value)
+		}
+		return value, nil
+	case "enum":
+		for _, allowed := range schema.Values {
+			if value == allowed {
+				return value, nil
+			}
+		}
+		return nil, fmt.Errorf("%q is not one of %s", value, strings.Join(schema.Values, ", "))
+	default:
+		return value, nil
+	}
+
+	if schema.Min != nil && number < *schema.Min {
+		return nil, fmt.Errorf("%q is less than %v", value, *schema.Min)
+	}
+	if schema.Max != nil && number > *schema.Max {
+		return nil, fmt.Errorf("%q is greater than %v", value, *schema.Max)
+	}
+	return typed, nil
+}
+
+//Add type, typed value and unit to the configuration entries with schema. Values not valid by the schema
+//(e.g. written before the schema was defined) are kept only in the string form.
+func typeConfiguration(schemas map[string]models.ConfigurationKeySchema, list []models.Configuration) []models.Configuration {
+	for i := range list {
+		schema, ok := schemas[list[i].Key]
+		if !ok {
+			continue
+		}
+		list[i].Type = schema.Type
+		list[i].Unit = schema.Unit
+		if typed, err := parseConfigurationValue(schema, list[i].Value); err == nil {
+			list[i].TypedValue = typed
+		}
+	}
+	return list
+}
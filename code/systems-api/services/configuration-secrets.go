@@ -0,0 +1,104 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"panda/apigateway/models"
+	"strings"
+)
+
+//Stored values of the secret configuration entries start with this prefix followed by the base64 encoded nonce and ciphertext.
+//The prefix marks the entry as secret also in the configuration revisions.
+const secretConfigurationValuePrefix = "enc:v1:"
+
+//Value returned instead of the secret configuration value in all normal reads
+const MaskedConfigurationValue = "********"
+
+var errInvalidSecretConfigurationValue = errors.New("Invalid encrypted configuration value")
+
+//Encrypts the secret configuration values with AES-GCM before they are stored, the AES key is derived from the server-side key
+type ConfigurationSecretCipher struct {
+	aead cipher.AEAD
+}
+
+func NewConfigurationSecretCipher(key string) (*ConfigurationSecretCipher, error) {
+	if key == "" {
+		return nil, errors.New("Configuration secret key is empty")
+	}
+	hash := sha256.Sum256([]byte(key))
+	block, err := aes.NewCipher(hash[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &ConfigurationSecretCipher{aead: aead}, nil
+}
+
+func (sc *ConfigurationSecretCipher) encrypt(value string) (string, error) {
+	nonce := make([]byte, sc.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := sc.aead.Seal(nonce, nonce, []byte(value), nil)
+	return secretConfigurationValuePrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (sc *ConfigurationSecretCipher) decrypt(stored string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, secretConfigurationValuePrefix))
+	if err != nil || len(sealed) < sc.aead.NonceSize() {
+		return "", errInvalidSecretConfigurationValue
+	}
+	nonceSize := sc.aead.NonceSize()
+	value, err := sc.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], nil)
+	if err != nil {
+		return "", errInvalidSecretConfigurationValue
+	}
+	return string(value), nil
+}
+
+func isSecretConfigurationValue(value string) bool {
+	return strings.HasPrefix(value, secretConfigurationValuePrefix)
+}
+
+//Replace the stored secret values of the configuration list by the mask
+func maskConfiguration(list []models.Configuration) []models.Configuration {
+	for i := range list {
+		if list[i].Secret || isSecretConfigurationValue(list[i].Value) {
+			list[i].Secret = true
+			list[i].Value = MaskedConfigurationValue
+			list[i].TypedValue = nil
+		}
+	}
+	return list
+}
+
+//Copy of the configuration changes with the secret values replaced by the mask
+func maskConfigurationChanges(changes []models.ConfigurationChange) []models.ConfigurationChange {
+	masked := make([]models.ConfigurationChange, len(changes))
+	mask := MaskedConfigurationValue
+	for i, change := range changes {
+		masked[i] = change
+		if change.OldValue != nil && isSecretConfigurationValue(*change.OldValue) {
+			masked[i].OldValue = &mask
+		}
+		if change.NewValue != nil && isSecretConfigurationValue(*change.NewValue) {
+			masked[i].NewValue = &mask
+		}
+	}
+	return masked
+}
+
+func maskConfigurationRevisions(revisions []models.ConfigurationRevision) []models.ConfigurationRevision {
+	for i := range revisions {
+		revisions[i].Changes = maskConfigurationChanges(revisions[i].Changes)
+	}
+	return revisions
+}
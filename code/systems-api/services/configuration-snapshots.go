@@ -0,0 +1,153 @@
+package services
+
+import (
+	"encoding/json"
+	"panda/apigateway/models"
+	"sort"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+//Write lock of all Systems in the subtree, see lockSystemConfiguration. The Systems are locked ordered by code.
+func lockSubtreeConfigurations(tx neo4j.Transaction, systemCode string) error {
+	_, err := tx.Run(`MATCH (root:System{code: $systemCode})-[:HAS_SUBSYSTEM*0..]->(s:System)
+	WITH s ORDER BY s.code
+	SET s.configurationLock = true
+	REMOVE s.configurationLock`, map[string]interface{}{
+		"systemCode": systemCode,
+	})
+	return err
+}
+
+//Read the current configuration of all Systems in the subtree as key-value maps by System code
+func readSubtreeConfigurations(tx neo4j.Transaction, systemCode string) (map[string]map[string]string, error) {
+	reader, err := tx.Run(`MATCH (root:System{code: $systemCode})-[:HAS_SUBSYSTEM*0..]->(s:System)
+	OPTIONAL MATCH (s)-[:HAS]->(c:Config)
+	RETURN s.code, c.key, c.value`, map[string]interface{}{
+		"systemCode": systemCode,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	configurations := make(map[string]map[string]string)
+	for reader.Next() {
+		code := reader.Record().Values[0].(string)
+		if _, ok := configurations[code]; !ok {
+			configurations[code] = make(map[string]string)
+		}
+		if key, ok := reader.Record().Values[1].(string); ok {
+			configurations[code][key] = reader.Record().Values[2].(string)
+		}
+	}
+	if err = reader.Err(); err != nil {
+		return nil, err
+	}
+	if len(configurations) == 0 {
+		return nil, ErrSystemNotFound
+	}
+
+	return configurations, nil
+}
+
+//Read the configurations stored in the snapshot of the System subtree by the current codes of the Systems. The snapshot
+//is linked to its Systems by SNAPSHOT_OF, so renamed Systems are still found. Codes of the deleted Systems are returned ordered.
+func readConfigurationSnapshot(tx neo4j.Transaction, systemCode string, name string) (map[string]map[string]string, []string, error) {
+	reader, err := tx.Run(`MATCH (:System{code: $systemCode})-[:HAS_SNAPSHOT]->(snapshot:ConfigSnapshot{name: $name})
+	RETURN snapshot.configurations, [(snapshot)-[r:SNAPSHOT_OF]->(s:System) | [r.systemCode, s.code]]`, map[string]interface{}{
+		"systemCode": systemCode,
+		"name":       name,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if !reader.Next() {
+		if err = reader.Err(); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrConfigurationSnapshotNotFound
+	}
+
+	stored := make(map[string]map[string]string)
+	if err = json.Unmarshal([]byte(reader.Record().Values[0].(string)), &stored); err != nil {
+		return nil, nil, err
+	}
+	configurations := make(map[string]map[string]string, len(stored))
+	for _, link := range reader.Record().Values[1].([]interface{}) {
+		codes := link.([]interface{})
+		if configuration, ok := stored[codes[0].(string)]; ok {
+			configurations[codes[1].(string)] = configuration
+			delete(stored, codes[0].(string))
+		}
+	}
+	deleted := make([]string, 0, len(stored))
+	for code := range stored {
+		deleted = append(deleted, code)
+	}
+	sort.Strings(deleted)
+	return configurations, deleted, nil
+}
+
+func readConfigurationSnapshots(tx neo4j.Transaction, systemCode string) ([]models.ConfigurationSnapshot, error) {
+	reader, err := tx.Run(`MATCH (s:System{code: $systemCode})-[:HAS_SNAPSHOT]->(snapshot:ConfigSnapshot)
+	RETURN snapshot.name, snapshot.date, snapshot.username, snapshot.systemCount order by snapshot.date`, map[string]interface{}{
+		"systemCode": systemCode,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]models.ConfigurationSnapshot, 0)
+	for reader.Next() {
+		list = append(list, models.ConfigurationSnapshot{
+			Name:        reader.Record().Values[0].(string),
+			SystemCode:  systemCode,
+			When:        reader.Record().Values[1].(time.Time),
+			Username:    reader.Record().Values[2].(string),
+			SystemCount: int(reader.Record().Values[3].(int64)),
+		})
+	}
+	if err = reader.Err(); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+//Changes turning the from configurations to the to configurations for the Systems present in both, ordered by System code
+func diffSubtreeConfigurations(from map[string]map[string]string, to map[string]map[string]string) []models.SystemConfigurationChanges {
+	list := make([]models.SystemConfigurationChanges, 0)
+	for systemCode, fromConfiguration := range from {
+		toConfiguration, ok := to[systemCode]
+		if !ok {
+			continue
+		}
+		if changes := diffConfigurations(fromConfiguration, toConfiguration); len(changes) > 0 {
+			list = append(list, models.SystemConfigurationChanges{SystemCode: systemCode, Changes: changes})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].SystemCode < list[j].SystemCode
+	})
+	return list
+}
+
+//Codes of the Systems in the configurations missing in the other configurations and the deleted codes, ordered
+func missingSystemCodes(configurations map[string]map[string]string, other map[string]map[string]string, deleted []string) []string {
+	list := append(make([]string, 0), deleted...)
+	for systemCode := range configurations {
+		if _, ok := other[systemCode]; !ok {
+			list = append(list, systemCode)
+		}
+	}
+	sort.Strings(list)
+	return list
+}
+
+func maskSystemConfigurationChanges(list []models.SystemConfigurationChanges) []models.SystemConfigurationChanges {
+	for i := range list {
+		list[i].Changes = maskConfigurationChanges(list[i].Changes)
+	}
+	return list
+}
@@ -0,0 +1,127 @@
+package services
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"panda/apigateway/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+var ErrInvalidMaintenanceCursor = errors.New("Invalid maintenance cursor")
+
+//Condition of the maintenance m of the System s by the User u matching the filter, the cursor is not included
+const maintenanceFilterCondition = `($systemCode = '' OR s.code = $systemCode OR ($subtree AND exists((:System{code: $systemCode})-[:HAS_SUBSYSTEM*1..]->(s))))
+	AND ($from IS NULL OR m.date >= $from) AND ($to IS NULL OR m.date <= $to)
+	AND ($username = '' OR u.username = $username) AND ($type = '' OR m.type = $type)`
+
+func maintenanceFilterParams(filter models.MaintenanceFilter) map[string]interface{} {
+	return map[string]interface{}{
+		"systemCode": filter.SystemCode,
+		"subtree":    filter.Subtree,
+		"from":       timeParam(filter.From),
+		"to":         timeParam(filter.To),
+		"username":   filter.Username,
+		"type":       filter.Type,
+	}
+}
+
+//Read the page of the maintenance matching the filter ordered by date, with the total count of the matching maintenance
+func readMaintenancePage(tx neo4j.Transaction, filter models.MaintenanceFilter) (*models.MaintenancePage, error) {
+	params := maintenanceFilterParams(filter)
+	order, comparison := "ASC", ">"
+	if filter.Descending {
+		order, comparison = "DESC", "<"
+	}
+	cursorCondition := ""
+	if filter.Cursor != "" {
+		cursorDate, cursorKey, err := decodeMaintenanceCursor(filter)
+		if err != nil {
+			return nil, err
+		}
+		cursorCondition = ` AND (m.date ` + comparison + ` $cursorDate OR (m.date = $cursorDate AND key ` + comparison + ` $cursorKey))`
+		params["cursorDate"] = cursorDate
+		params["cursorKey"] = cursorKey
+	}
+	limit := ""
+	if filter.Limit > 0 {
+		//one more to know if there is a next page
+		limit = " LIMIT " + strconv.Itoa(filter.Limit+1)
+	}
+
+	if filter.SystemCode != "" {
+		if err := checkSystemExists(tx, filter.SystemCode); err != nil {
+			return nil, err
+		}
+	}
+
+	reader, err := tx.Run(`MATCH (s:System)-[m:WAS_MAINTAINED_BY]->(u:User) WHERE `+maintenanceFilterCondition+` RETURN count(m)`, params)
+	if err != nil {
+		return nil, err
+	}
+	record, err := reader.Single()
+	if err != nil {
+		return nil, err
+	}
+	page := models.MaintenancePage{TotalCount: record.Values[0].(int64), Items: make([]models.Maintenance, 0)}
+
+	reader, err = tx.Run(`MATCH (s:System)-[m:WAS_MAINTAINED_BY]->(u:User) WHERE `+maintenanceFilterCondition+` 
+	WITH s, m, u, m.id AS key WHERE true`+cursorCondition+` 
+	RETURN m.date, u.username, s.name, s.code, key, coalesce(m.type, ''), coalesce(m.description, ''), coalesce(m.duration, '') 
+	ORDER BY m.date `+order+`, key `+order+limit, params)
+	if err != nil {
+		return nil, err
+	}
+
+	for reader.Next() {
+		page.Items = append(page.Items, maintenanceFromRecord(reader.Record()))
+	}
+	if err = reader.Err(); err != nil {
+		return nil, err
+	}
+
+	if filter.Limit > 0 && len(page.Items) > filter.Limit {
+		page.Items = page.Items[:filter.Limit]
+		page.NextCursor = encodeMaintenanceCursor(filter, page.Items[filter.Limit-1])
+	}
+	return &page, nil
+}
+
+//Cursor is the fingerprint of the filter and order, the date and the key of the last listed maintenance, the key breaks ties of the same date.
+//The cursor is valid only for the same filter and order, otherwise the rows would be skipped or repeated.
+func encodeMaintenanceCursor(filter models.MaintenanceFilter, maintenance models.Maintenance) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(maintenanceFilterFingerprint(filter) + "|" + maintenance.When.Format(time.RFC3339Nano) + "|" + maintenance.Id))
+}
+
+func decodeMaintenanceCursor(filter models.MaintenanceFilter) (time.Time, string, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(filter.Cursor)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidMaintenanceCursor
+	}
+	parts := strings.SplitN(string(decoded), "|", 3)
+	if len(parts) != 3 || parts[0] != maintenanceFilterFingerprint(filter) {
+		return time.Time{}, "", ErrInvalidMaintenanceCursor
+	}
+	when, err := time.Parse(time.RFC3339Nano, parts[1])
+	if err != nil {
+		return time.Time{}, "", ErrInvalidMaintenanceCursor
+	}
+	return when, parts[2], nil
+}
+
+func maintenanceFilterFingerprint(filter models.MaintenanceFilter) string {
+	formatTime := func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.UTC().Format(time.RFC3339Nano)
+	}
+	hash := fnv.New32a()
+	fmt.Fprintf(hash, "%s|%t|%s|%s|%s|%s|%t", filter.SystemCode, filter.Subtree, formatTime(filter.From), formatTime(filter.To), filter.Username, filter.Type, filter.Descending)
+	return fmt.Sprintf("%08x", hash.Sum32())
+}
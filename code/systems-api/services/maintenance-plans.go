@@ -0,0 +1,65 @@
+package services
+
+import (
+	"panda/apigateway/models"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+//Read the maintenance plans of the System, or of the whole subtree, with the last maintenance and the next due date.
+//Plans of all Systems are read if the System code is empty, plans of all technicians if the username is empty.
+func readMaintenancePlans(tx neo4j.Transaction, systemCode string, subtree bool, username string) ([]models.MaintenancePlan, error) {
+	if systemCode != "" {
+		if err := checkSystemExists(tx, systemCode); err != nil {
+			return nil, err
+		}
+	}
+
+	depth := "0"
+	if subtree {
+		depth = "0.."
+	}
+	reader, err := tx.Run(`MATCH (s:System)-[:HAS_MAINTENANCE_PLAN]->(p:MaintenancePlan)
+	WHERE ($systemCode = '' OR exists((:System{code: $systemCode})-[:HAS_SUBSYSTEM*`+depth+`]->(s))) 
+	AND ($username = '' OR p.username = $username)
+	OPTIONAL MATCH (s)-[m:WAS_MAINTAINED_BY]->() WHERE p.type = '' OR m.type = p.type
+	RETURN p.id, s.code, s.name, p.name, p.type, p.description, p.frequency, p.interval, p.rrule, p.start, max(m.date), coalesce(p.username, '')
+	ORDER BY s.code, p.name`, map[string]interface{}{
+		"systemCode": systemCode,
+		"username":   username,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	list := make([]models.MaintenancePlan, 0)
+	for reader.Next() {
+		values := reader.Record().Values
+		plan := models.MaintenancePlan{
+			Id:          values[0].(string),
+			SystemCode:  values[1].(string),
+			SystemName:  values[2].(string),
+			Name:        values[3].(string),
+			Type:        values[4].(string),
+			Description: values[5].(string),
+			Frequency:   values[6].(string),
+			Interval:    int(values[7].(int64)),
+			RRule:       values[8].(string),
+			Start:       values[9].(time.Time),
+			Username:    values[11].(string),
+		}
+		if lastMaintained, ok := values[10].(time.Time); ok {
+			plan.LastMaintained = &lastMaintained
+		}
+		plan.NextDue = nextMaintenanceDue(plan, plan.LastMaintained)
+		plan.Overdue = plan.NextDue != nil && plan.NextDue.Before(now)
+		list = append(list, plan)
+	}
+	if err = reader.Err(); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
@@ -0,0 +1,384 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"panda/apigateway/models"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//Frequencies of the maintenance plans
+const (
+	MaintenanceFrequencyDays    = "days"
+	MaintenanceFrequencyMonthly = "monthly"
+	MaintenanceFrequencyRRule   = "rrule"
+)
+
+var ErrInvalidMaintenancePlan = errors.New("Invalid maintenance plan")
+
+//How many recurrence periods are searched for the next occurrence, rules like BYMONTHDAY=31;BYMONTH=2 never occur.
+//The search starts at the period of the last maintenance, unless the rule counts its occurrences from the start.
+const rruleMaxPeriods = 10000
+
+var rruleWeekdays = map[string]time.Weekday{
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+	"SU": time.Sunday,
+}
+
+type rruleWeekday struct {
+	weekday time.Weekday
+	//nth weekday of the month, negative from the month end, 0 is every such weekday
+	ordinal int
+}
+
+//Subset of the iCalendar RRULE: FREQ of DAILY, WEEKLY, MONTHLY or YEARLY with INTERVAL, COUNT, UNTIL, BYMONTH, BYMONTHDAY and BYDAY
+type rrule struct {
+	freq       string
+	interval   int
+	count      int
+	until      *time.Time
+	byMonth    []int
+	byMonthDay []int
+	byDay      []rruleWeekday
+}
+
+func parseRRule(value string) (*rrule, error) {
+	rule := rrule{interval: 1}
+	value = strings.TrimPrefix(strings.TrimSpace(value), "RRULE:")
+	for _, part := range strings.Split(value, ";") {
+		name, partValue, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid RRULE part %q", part)
+		}
+		var err error
+		switch strings.ToUpper(name) {
+		case "FREQ":
+			rule.freq = strings.ToUpper(partValue)
+			if rule.freq != "DAILY" && rule.freq != "WEEKLY" && rule.freq != "MONTHLY" && rule.freq != "YEARLY" {
+				return nil, fmt.Errorf("unsupported RRULE FREQ %s", partValue)
+			}
+		case "INTERVAL":
+			rule.interval, err = strconv.Atoi(partValue)
+			if err != nil || rule.interval < 1 {
+				return nil, fmt.Errorf("invalid RRULE INTERVAL %s", partValue)
+			}
+		case "COUNT":
+			rule.count, err = strconv.Atoi(partValue)
+			if err != nil || rule.count < 1 {
+				return nil, fmt.Errorf("invalid RRULE COUNT %s", partValue)
+			}
+		case "UNTIL":
+			until, err := parseRRuleTime(partValue)
+			if err != nil {
+				return nil, fmt.Errorf("invalid RRULE UNTIL %s", partValue)
+			}
+			rule.until = &until
+		case "BYMONTH":
+			rule.byMonth, err = parseRRuleNumbers(partValue, 1, 12)
+			if err != nil {
+				return nil, fmt.Errorf("invalid RRULE BYMONTH %s", partValue)
+			}
+		case "BYMONTHDAY":
+			rule.byMonthDay, err = parseRRuleNumbers(partValue, -31, 31)
+			if err != nil {
+				return nil, fmt.Errorf("invalid RRULE BYMONTHDAY %s", partValue)
+			}
+		case "BYDAY":
+			for _, day := range strings.Split(partValue, ",") {
+				day = strings.ToUpper(day)
+				if len(day) < 2 {
+					return nil, fmt.Errorf("invalid RRULE BYDAY %s", partValue)
+				}
+				weekday, ok := rruleWeekdays[day[len(day)-2:]]
+				if !ok {
+					return nil, fmt.Errorf("invalid RRULE BYDAY %s", partValue)
+				}
+				ordinal := 0
+				if len(day) > 2 {
+					ordinal, err = strconv.Atoi(day[:len(day)-2])
+					if err != nil || ordinal == 0 || ordinal < -5 || ordinal > 5 {
+						return nil, fmt.Errorf("invalid RRULE BYDAY %s", partValue)
+					}
+				}
+				rule.byDay = append(rule.byDay, rruleWeekday{weekday: weekday, ordinal: ordinal})
+			}
+		default:
+			return nil, fmt.Errorf("unsupported RRULE part %s", name)
+		}
+	}
+
+	if rule.freq == "" {
+		return nil, errors.New("RRULE FREQ is required")
+	}
+	if rule.count > 0 && rule.until != nil {
+		return nil, errors.New("RRULE COUNT and UNTIL cannot be combined")
+	}
+	for _, day := range rule.byDay {
+		if day.ordinal != 0 && rule.freq != "MONTHLY" && rule.freq != "YEARLY" {
+			return nil, errors.New("RRULE BYDAY with ordinal is supported only in MONTHLY and YEARLY rules")
+		}
+	}
+	if rule.freq == "YEARLY" && len(rule.byDay) > 0 && len(rule.byMonth) == 0 {
+		return nil, errors.New("RRULE BYDAY in YEARLY rule requires BYMONTH")
+	}
+	return &rule, nil
+}
+
+func parseRRuleTime(value string) (time.Time, error) {
+	for _, layout := range []string{"20060102T150405Z", "20060102T150405", "20060102"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.New("invalid time")
+}
+
+func parseRRuleNumbers(value string, min int, max int) ([]int, error) {
+	numbers := make([]int, 0)
+	for _, item := range strings.Split(value, ",") {
+		number, err := strconv.Atoi(item)
+		if err != nil || number < min || number > max || number == 0 {
+			return nil, errors.New("invalid number")
+		}
+		numbers = append(numbers, number)
+	}
+	return numbers, nil
+}
+
+//First occurrence of the rule starting at start which is after the time, or at the time if inclusive. Nil if the rule has no more occurrences.
+func (rule *rrule) next(start time.Time, after time.Time, inclusive bool) *time.Time {
+	occurrences := 0
+	first := rule.firstPeriod(start, after)
+	for period := first; period < first+rruleMaxPeriods; period++ {
+		for _, candidate := range rule.periodCandidates(start, period*rule.interval) {
+			if candidate.Before(start) {
+				continue
+			}
+			if rule.until != nil && candidate.After(*rule.until) {
+				return nil
+			}
+			occurrences++
+			if rule.count > 0 && occurrences > rule.count {
+				return nil
+			}
+			if candidate.After(after) || (inclusive && candidate.Equal(after)) {
+				return &candidate
+			}
+		}
+	}
+	return nil
+}
+
+//First period which can have occurrences after the time, the periods before it are skipped unless the occurrences are counted
+func (rule *rrule) firstPeriod(start time.Time, after time.Time) int {
+	if rule.count > 0 || !after.After(start) {
+		return 0
+	}
+	units := 0
+	switch rule.freq {
+	case "DAILY":
+		units = int(after.Sub(start).Hours() / 24)
+	case "WEEKLY":
+		units = int(after.Sub(start).Hours() / 24 / 7)
+	case "MONTHLY":
+		units = (after.Year()-start.Year())*12 + int(after.Month()) - int(start.Month())
+	case "YEARLY":
+		units = after.Year() - start.Year()
+	}
+	//one period earlier, so the periods shortened by the daylight saving time are not skipped
+	period := units/rule.interval - 1
+	if period < 0 {
+		return 0
+	}
+	return period
+}
+
+//Ordered occurrences of the rule in the period shifted by offset periods from the period of the start
+func (rule *rrule) periodCandidates(start time.Time, offset int) []time.Time {
+	at := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, start.Hour(), start.Minute(), start.Second(), 0, start.Location())
+	}
+	candidates := make([]time.Time, 0)
+	switch rule.freq {
+	case "DAILY":
+		day := start.AddDate(0, 0, offset)
+		if rule.matchesMonth(day.Month()) && rule.matchesMonthDay(day) && rule.matchesWeekday(day.Weekday()) {
+			candidates = append(candidates, day)
+		}
+	case "WEEKLY":
+		//weeks start on Monday
+		monday := start.AddDate(0, 0, -((int(start.Weekday())+6)%7)+offset*7)
+		weekdays := []rruleWeekday{{weekday: start.Weekday()}}
+		if len(rule.byDay) > 0 {
+			weekdays = rule.byDay
+		}
+		for _, weekday := range weekdays {
+			day := monday.AddDate(0, 0, (int(weekday.weekday)+6)%7)
+			day = at(day.Year(), day.Month(), day.Day())
+			if rule.matchesMonth(day.Month()) {
+				candidates = append(candidates, day)
+			}
+		}
+	case "MONTHLY":
+		first := time.Date(start.Year(), start.Month()+time.Month(offset), 1, 0, 0, 0, 0, start.Location())
+		if rule.matchesMonth(first.Month()) {
+			for _, day := range rule.monthDays(first.Year(), first.Month(), start.Day()) {
+				candidates = append(candidates, at(first.Year(), first.Month(), day))
+			}
+		}
+	case "YEARLY":
+		year := start.Year() + offset
+		months := rule.byMonth
+		if len(months) == 0 {
+			months = []int{int(start.Month())}
+		}
+		for _, month := range months {
+			for _, day := range rule.monthDays(year, time.Month(month), start.Day()) {
+				candidates = append(candidates, at(year, time.Month(month), day))
+			}
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Before(candidates[j]) })
+	return candidates
+}
+
+//Days of the month matching BYMONTHDAY and BYDAY, or the default day if the rule has none of them
+func (rule *rrule) monthDays(year int, month time.Month, defaultDay int) []int {
+	daysInMonth := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	days := make([]int, 0)
+	for day := 1; day <= daysInMonth; day++ {
+		date := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+		if len(rule.byMonthDay) == 0 && len(rule.byDay) == 0 {
+			if day == defaultDay {
+				days = append(days, day)
+			}
+			continue
+		}
+		if !rule.matchesMonthDay(date) {
+			continue
+		}
+		if len(rule.byDay) > 0 && !rule.matchesMonthWeekday(date, daysInMonth) {
+			continue
+		}
+		days = append(days, day)
+	}
+	return days
+}
+
+func (rule *rrule) matchesMonth(month time.Month) bool {
+	if len(rule.byMonth) == 0 {
+		return true
+	}
+	for _, m := range rule.byMonth {
+		if time.Month(m) == month {
+			return true
+		}
+	}
+	return false
+}
+
+func (rule *rrule) matchesMonthDay(date time.Time) bool {
+	if len(rule.byMonthDay) == 0 {
+		return true
+	}
+	daysInMonth := time.Date(date.Year(), date.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	for _, day := range rule.byMonthDay {
+		if day == date.Day() || (day < 0 && daysInMonth+day+1 == date.Day()) {
+			return true
+		}
+	}
+	return false
+}
+
+func (rule *rrule) matchesWeekday(weekday time.Weekday) bool {
+	if len(rule.byDay) == 0 {
+		return true
+	}
+	for _, day := range rule.byDay {
+		if day.weekday == weekday {
+			return true
+		}
+	}
+	return false
+}
+
+func (rule *rrule) matchesMonthWeekday(date time.Time, daysInMonth int) bool {
+	for _, day := range rule.byDay {
+		if day.weekday != date.Weekday() {
+			continue
+		}
+		if day.ordinal == 0 ||
+			(day.ordinal > 0 && (date.Day()-1)/7+1 == day.ordinal) ||
+			(day.ordinal < 0 && (daysInMonth-date.Day())/7+1 == -day.ordinal) {
+			return true
+		}
+	}
+	return false
+}
+
+func validateMaintenancePlan(plan models.MaintenancePlan) error {
+	invalid := func(message string) error {
+		return fmt.Errorf("%w: %s", ErrInvalidMaintenancePlan, message)
+	}
+	if plan.Name == "" {
+		return invalid("name is required")
+	}
+	if plan.Type != "" && plan.Type != MaintenanceTypeInspection && plan.Type != MaintenanceTypeRepair && plan.Type != MaintenanceTypeCalibration {
+		return invalid("type must be inspection, repair or calibration")
+	}
+	switch plan.Frequency {
+	case MaintenanceFrequencyDays, MaintenanceFrequencyMonthly:
+		if plan.Interval < 1 {
+			return invalid("interval must be at least 1")
+		}
+	case MaintenanceFrequencyRRule:
+		if _, err := parseRRule(plan.RRule); err != nil {
+			return invalid(err.Error())
+		}
+	default:
+		return invalid("frequency must be days, monthly or rrule")
+	}
+	return nil
+}
+
+//Next due date of the valid maintenance plan after the last maintenance, nil if the plan has no more occurrences
+func nextMaintenanceDue(plan models.MaintenancePlan, lastMaintained *time.Time) *time.Time {
+	if plan.Frequency == MaintenanceFrequencyRRule {
+		rule, err := parseRRule(plan.RRule)
+		if err != nil {
+			return nil
+		}
+		if lastMaintained == nil {
+			return rule.next(plan.Start, plan.Start, true)
+		}
+		return rule.next(plan.Start, *lastMaintained, false)
+	}
+
+	if lastMaintained == nil {
+		start := plan.Start
+		return &start
+	}
+	next := lastMaintained.AddDate(0, 0, plan.Interval)
+	if plan.Frequency == MaintenanceFrequencyMonthly {
+		next = addMonthsClamped(*lastMaintained, plan.Interval)
+	}
+	return &next
+}
+
+//Same day of the month after the months, clamped to the last day of the shorter month (Jan 31 + 1 month is Feb 28)
+func addMonthsClamped(t time.Time, months int) time.Time {
+	first := time.Date(t.Year(), t.Month()+time.Month(months), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	day := t.Day()
+	if daysInMonth := time.Date(first.Year(), first.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day(); day > daysInMonth {
+		day = daysInMonth
+	}
+	return time.Date(first.Year(), first.Month(), day, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+}
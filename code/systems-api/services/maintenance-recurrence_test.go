@@ -0,0 +1,180 @@
+package services
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestParseRRuleRejects(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"empty", ""},
+		{"missing FREQ", "INTERVAL=2"},
+		{"unsupported FREQ", "FREQ=HOURLY"},
+		{"part without value", "FREQ=DAILY;COUNT"},
+		{"unsupported part", "FREQ=MONTHLY;BYSETPOS=-1"},
+		{"zero INTERVAL", "FREQ=DAILY;INTERVAL=0"},
+		{"zero COUNT", "FREQ=DAILY;COUNT=0"},
+		{"invalid UNTIL", "FREQ=DAILY;UNTIL=tomorrow"},
+		{"COUNT with UNTIL", "FREQ=DAILY;COUNT=2;UNTIL=20240101"},
+		{"BYMONTH out of range", "FREQ=YEARLY;BYMONTH=13"},
+		{"zero BYMONTHDAY", "FREQ=MONTHLY;BYMONTHDAY=0"},
+		{"BYMONTHDAY out of range", "FREQ=MONTHLY;BYMONTHDAY=-32"},
+		{"unknown BYDAY", "FREQ=WEEKLY;BYDAY=XX"},
+		{"BYDAY ordinal out of range", "FREQ=MONTHLY;BYDAY=6MO"},
+		{"BYDAY ordinal in WEEKLY", "FREQ=WEEKLY;BYDAY=1MO"},
+		{"YEARLY BYDAY without BYMONTH", "FREQ=YEARLY;BYDAY=MO"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := parseRRule(test.value); err == nil {
+				t.Errorf("parseRRule(%q) accepted the rule", test.value)
+			}
+		})
+	}
+}
+
+func TestParseRRuleAccepts(t *testing.T) {
+	for _, value := range []string{
+		"FREQ=DAILY",
+		"RRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR",
+		"freq=monthly;byday=-1fr",
+		"FREQ=MONTHLY;BYMONTHDAY=1,-1;UNTIL=20241231T235959Z",
+		"FREQ=YEARLY;BYMONTH=3;BYDAY=2SU;COUNT=5",
+	} {
+		if _, err := parseRRule(value); err != nil {
+			t.Errorf("parseRRule(%q) failed: %v", value, err)
+		}
+	}
+}
+
+func TestRRuleNext(t *testing.T) {
+	prague, err := time.LoadLocation("Europe/Prague")
+	if err != nil {
+		t.Fatal(err)
+	}
+	utc := func(year int, month time.Month, day int, hour int) time.Time {
+		return time.Date(year, month, day, hour, 0, 0, 0, time.UTC)
+	}
+	local := func(year int, month time.Month, day int, hour int) time.Time {
+		return time.Date(year, month, day, hour, 0, 0, 0, prague)
+	}
+	tests := []struct {
+		name      string
+		rule      string
+		start     time.Time
+		after     time.Time
+		inclusive bool
+		//nil when the rule has no more occurrences
+		want *time.Time
+	}{
+		{"start is the first occurrence", "FREQ=DAILY", utc(2024, 1, 1, 10), utc(2024, 1, 1, 10), true, ptr(utc(2024, 1, 1, 10))},
+		{"interval skips the periods", "FREQ=DAILY;INTERVAL=10", utc(2020, 1, 1, 10), utc(2024, 1, 1, 0), false, ptr(utc(2024, 1, 10, 10))},
+		{"COUNT last occurrence", "FREQ=DAILY;COUNT=3", utc(2024, 1, 1, 10), utc(2024, 1, 2, 10), false, ptr(utc(2024, 1, 3, 10))},
+		{"COUNT terminates", "FREQ=DAILY;COUNT=3", utc(2024, 1, 1, 10), utc(2024, 1, 3, 10), false, nil},
+		{"COUNT counts from the start", "FREQ=WEEKLY;BYDAY=MO,TH;COUNT=4", utc(2024, 1, 1, 8), utc(2024, 1, 8, 8), false, ptr(utc(2024, 1, 11, 8))},
+		{"UNTIL last occurrence", "FREQ=WEEKLY;UNTIL=20240115T000000Z", utc(2024, 1, 1, 10), utc(2024, 1, 1, 10), false, ptr(utc(2024, 1, 8, 10))},
+		{"UNTIL terminates", "FREQ=WEEKLY;UNTIL=20240115T000000Z", utc(2024, 1, 1, 10), utc(2024, 1, 8, 10), false, nil},
+		{"last Friday of the month", "FREQ=MONTHLY;BYDAY=-1FR", utc(2024, 1, 1, 9), utc(2024, 1, 1, 9), true, ptr(utc(2024, 1, 26, 9))},
+		{"last Friday of the leap February", "FREQ=MONTHLY;BYDAY=-1FR", utc(2024, 1, 1, 9), utc(2024, 1, 26, 9), false, ptr(utc(2024, 2, 23, 9))},
+		{"second Sunday of March", "FREQ=YEARLY;BYMONTH=3;BYDAY=2SU", utc(2024, 1, 1, 9), utc(2024, 3, 10, 9), false, ptr(utc(2025, 3, 9, 9))},
+		{"last day of January", "FREQ=MONTHLY;BYMONTHDAY=-1", utc(2024, 1, 15, 7), utc(2024, 1, 15, 7), true, ptr(utc(2024, 1, 31, 7))},
+		{"last day of the leap February", "FREQ=MONTHLY;BYMONTHDAY=-1", utc(2024, 1, 15, 7), utc(2024, 1, 31, 7), false, ptr(utc(2024, 2, 29, 7))},
+		{"last day of February", "FREQ=MONTHLY;BYMONTHDAY=-1", utc(2023, 1, 15, 7), utc(2023, 1, 31, 7), false, ptr(utc(2023, 2, 28, 7))},
+		{"day 31 skips the shorter months", "FREQ=MONTHLY;BYMONTHDAY=31", utc(2024, 1, 31, 7), utc(2024, 1, 31, 7), false, ptr(utc(2024, 3, 31, 7))},
+		{"February 29 in the leap years only", "FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=29", utc(2024, 2, 29, 7), utc(2024, 2, 29, 7), false, ptr(utc(2028, 2, 29, 7))},
+		{"never occurring MONTHLY", "FREQ=MONTHLY;BYMONTHDAY=30;BYMONTH=2", utc(2024, 1, 1, 7), utc(2024, 1, 1, 7), true, nil},
+		{"never occurring YEARLY", "FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=31", utc(2024, 1, 1, 7), utc(2024, 1, 1, 7), true, nil},
+		{"DAILY across the spring DST change", "FREQ=DAILY", local(2024, 3, 1, 8), local(2024, 3, 31, 8), false, ptr(local(2024, 4, 1, 8))},
+		{"DAILY at the spring DST change", "FREQ=DAILY", local(2024, 3, 1, 8), local(2024, 3, 31, 8), true, ptr(local(2024, 3, 31, 8))},
+		{"DAILY at the autumn DST change", "FREQ=DAILY", local(2024, 10, 1, 8), local(2024, 10, 27, 8), true, ptr(local(2024, 10, 27, 8))},
+		{"WEEKLY across the spring DST change", "FREQ=WEEKLY;INTERVAL=2", local(2024, 3, 4, 8), local(2024, 3, 18, 8), false, ptr(local(2024, 4, 1, 8))},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rule, err := parseRRule(test.rule)
+			if err != nil {
+				t.Fatalf("parseRRule(%q) failed: %v", test.rule, err)
+			}
+			got := rule.next(test.start, test.after, test.inclusive)
+			switch {
+			case test.want == nil && got != nil:
+				t.Errorf("next = %v, want no occurrence", *got)
+			case test.want != nil && got == nil:
+				t.Errorf("next = no occurrence, want %v", *test.want)
+			case test.want != nil && !got.Equal(*test.want):
+				t.Errorf("next = %v, want %v", *got, *test.want)
+			}
+		})
+	}
+}
+
+func TestRRuleFirstPeriodAcrossDST(t *testing.T) {
+	prague, err := time.LoadLocation("Europe/Prague")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rule, err := parseRRule("FREQ=DAILY")
+	if err != nil {
+		t.Fatal(err)
+	}
+	//the period of the occurrence at the time must not be skipped, even if the days before it were shortened or lengthened
+	tests := []struct {
+		start time.Time
+		after time.Time
+	}{
+		{time.Date(2024, 3, 1, 8, 0, 0, 0, prague), time.Date(2024, 3, 31, 8, 0, 0, 0, prague)},
+		{time.Date(2024, 3, 1, 8, 0, 0, 0, prague), time.Date(2024, 3, 31, 7, 59, 0, 0, prague)},
+		{time.Date(2024, 3, 1, 8, 0, 0, 0, prague), time.Date(2024, 4, 1, 8, 0, 0, 0, prague)},
+		{time.Date(2024, 10, 1, 8, 0, 0, 0, prague), time.Date(2024, 10, 27, 8, 0, 0, 0, prague)},
+		{time.Date(2024, 10, 1, 8, 0, 0, 0, prague), time.Date(2024, 10, 31, 7, 30, 0, 0, prague)},
+	}
+	for _, test := range tests {
+		period := rule.firstPeriod(test.start, test.after)
+		candidates := rule.periodCandidates(test.start, period*rule.interval)
+		if len(candidates) == 0 || candidates[0].After(test.after) {
+			t.Errorf("firstPeriod(%v, %v) = %d skips the occurrence at or before the time", test.start, test.after, period)
+		}
+	}
+
+	counted, err := parseRRule("FREQ=DAILY;COUNT=100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2024, 3, 1, 8, 0, 0, 0, prague)
+	if period := counted.firstPeriod(start, start.AddDate(0, 1, 0)); period != 0 {
+		t.Errorf("firstPeriod of the counted rule = %d, want 0", period)
+	}
+}
+
+func TestAddMonthsClamped(t *testing.T) {
+	tests := []struct {
+		name   string
+		from   time.Time
+		months int
+		want   time.Time
+	}{
+		{"Jan 31 to February", time.Date(2023, 1, 31, 9, 30, 0, 0, time.UTC), 1, time.Date(2023, 2, 28, 9, 30, 0, 0, time.UTC)},
+		{"Jan 31 to leap February", time.Date(2024, 1, 31, 9, 30, 0, 0, time.UTC), 1, time.Date(2024, 2, 29, 9, 30, 0, 0, time.UTC)},
+		{"Jan 31 to March", time.Date(2023, 1, 31, 9, 30, 0, 0, time.UTC), 2, time.Date(2023, 3, 31, 9, 30, 0, 0, time.UTC)},
+		{"Mar 31 to April", time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC), 1, time.Date(2024, 4, 30, 0, 0, 0, 0, time.UTC)},
+		{"leap day to the next year", time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC), 12, time.Date(2025, 2, 28, 12, 0, 0, 0, time.UTC)},
+		{"leap day to the next leap year", time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC), 48, time.Date(2028, 2, 29, 12, 0, 0, 0, time.UTC)},
+		{"across the year end", time.Date(2023, 11, 30, 12, 0, 0, 0, time.UTC), 3, time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC)},
+		{"day kept when it fits", time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC), 1, time.Date(2024, 2, 15, 12, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := addMonthsClamped(test.from, test.months); !got.Equal(test.want) {
+				t.Errorf("addMonthsClamped(%v, %d) = %v, want %v", test.from, test.months, got, test.want)
+			}
+		})
+	}
+}
+
+func ptr(t time.Time) *time.Time {
+	return &t
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"fmt"
+	"panda/apigateway/models"
+	"sort"
+	"time"
+)
+
+//Periods of the maintenance counts
+const (
+	MaintenancePeriodWeek    = "week"
+	MaintenancePeriodMonth   = "month"
+	MaintenancePeriodQuarter = "quarter"
+	MaintenancePeriodYear    = "year"
+)
+
+//Label of the period containing the time, e.g. 2022-W05, 2022-02, 2022-Q1 or 2022
+func maintenancePeriodLabel(period string, when time.Time) string {
+	switch period {
+	case MaintenancePeriodWeek:
+		year, week := when.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	case MaintenancePeriodQuarter:
+		return fmt.Sprintf("%d-Q%d", when.Year(), (int(when.Month())-1)/3+1)
+	case MaintenancePeriodYear:
+		return when.Format("2006")
+	default:
+		return when.Format("2006-01")
+	}
+}
+
+//Fill the statistics of the maintenance ordered by date, the maintenance can be of more Systems
+func computeMaintenanceStatistics(statistics *models.MaintenanceStatistics, maintenance []models.Maintenance, period string, top int) {
+	statistics.Count = len(maintenance)
+	statistics.CountsPerPeriod = make([]models.MaintenancePeriodCount, 0)
+	statistics.TopTechnicians = make([]models.TechnicianCount, 0)
+
+	periodCounts := make(map[string]int)
+	technicianCounts := make(map[string]int)
+	lastBySystem := make(map[string]time.Time)
+	var intervalsSum time.Duration
+	intervals := 0
+	for _, m := range maintenance {
+		periodCounts[maintenancePeriodLabel(period, m.When)]++
+		technicianCounts[m.Username]++
+		if last, ok := lastBySystem[m.SystemCode]; ok {
+			intervalsSum += m.When.Sub(last)
+			intervals++
+		}
+		lastBySystem[m.SystemCode] = m.When
+		if statistics.LastMaintained == nil || m.When.After(*statistics.LastMaintained) {
+			when := m.When
+			statistics.LastMaintained = &when
+		}
+	}
+
+	if intervals > 0 {
+		meanDays := intervalsSum.Hours() / 24 / float64(intervals)
+		statistics.MeanDaysBetweenMaintenance = &meanDays
+	}
+	for label, count := range periodCounts {
+		statistics.CountsPerPeriod = append(statistics.CountsPerPeriod, models.MaintenancePeriodCount{Period: label, Count: count})
+	}
+	sort.Slice(statistics.CountsPerPeriod, func(i, j int) bool {
+		return statistics.CountsPerPeriod[i].Period < statistics.CountsPerPeriod[j].Period
+	})
+	for username, count := range technicianCounts {
+		statistics.TopTechnicians = append(statistics.TopTechnicians, models.TechnicianCount{Username: username, Count: count})
+	}
+	sort.Slice(statistics.TopTechnicians, func(i, j int) bool {
+		if statistics.TopTechnicians[i].Count != statistics.TopTechnicians[j].Count {
+			return statistics.TopTechnicians[i].Count > statistics.TopTechnicians[j].Count
+		}
+		return statistics.TopTechnicians[i].Username < statistics.TopTechnicians[j].Username
+	})
+	if len(statistics.TopTechnicians) > top {
+		statistics.TopTechnicians = statistics.TopTechnicians[:top]
+	}
+}
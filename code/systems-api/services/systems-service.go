@@ -4,160 +4,1753 @@
 package services
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"panda/apigateway/models"
+	"sort"
+	"strconv"
 	"time"
 
 	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
 )
 
+var ErrSystemNotFound = errors.New("System not found")
+var ErrSystemCodeConflict = errors.New("System with this code already exists")
+var ErrParentSystemNotFound = errors.New("Parent system not found")
+var ErrSystemHierarchyCycle = errors.New("System cannot be moved into its own subtree")
+var ErrSystemHasSubsystems = errors.New("System has subsystems")
+var ErrSystemPathConflict = errors.New("Sibling Systems have the same name")
+var ErrConfigurationRevisionNotFound = errors.New("Configuration revision not found")
+var ErrConfigurationSecretNotFound = errors.New("Secret configuration key not found")
+var ErrConfigurationSnapshotNotFound = errors.New("Configuration snapshot not found")
+var ErrConfigurationSnapshotConflict = errors.New("Configuration snapshot with this name already exists")
+var ErrMaintenancePlanNotFound = errors.New("Maintenance plan not found")
+
+//Delete modes of the System with subsystems: refuse the delete, delete the whole subtree, or reattach subsystems to the parent
+const (
+	DeleteModeRestrict = "restrict"
+	DeleteModeCascade  = "cascade"
+	DeleteModeReattach = "reattach"
+)
+
+//Types of the maintenance events
+const (
+	MaintenanceTypeInspection  = "inspection"
+	MaintenanceTypeRepair      = "repair"
+	MaintenanceTypeCalibration = "calibration"
+)
+
+//Relationships to the nodes owned by the System, which are deleted together with the System
+const systemOwnedNodesRelationships = "HAS|LOG|WAS_MOVED|HAS_REVISION|HAS_SNAPSHOT|HAS_MAINTENANCE_PLAN"
+
+//How far in the future a logged time value can be, to tolerate clock differences of the sensor gateways
+const timeValueLogMaxClockSkew = 5 * time.Minute
+
 type SystemsService struct {
-	neo4jDriver neo4j.Driver
+	neo4jDriver          neo4j.Driver
+	timeValueBroadcaster ITimeValueBroadcaster
+	secretCipher         *ConfigurationSecretCipher
+}
+
+type ISystemsService interface {
+	CreateNewSystem(system models.System) (*models.ResponseMessage, error)
+	UpdateSystem(systemCode string, update models.SystemUpdate) (models.System, error)
+	MoveSystem(systemCode string, parentSystemCode string, username string) (*models.ResponseMessage, error)
+	GetSystemMoveHistory(systemCode string) ([]models.SystemMove, error)
+	DeleteSystemByCode(systemCode string, mode string, dryRun bool) (*models.SystemDeleteResult, error)
+	GetSystemByCode(systemCode string) (models.System, error)
+	GetSystemsByNameOrCode(searchText string, limit int32) ([]models.System, error)
+	GetSystemAncestors(systemCode string) ([]models.System, error)
+	GetSystemTree(systemCode string, depth int, withChildCount bool) (*models.SystemTreeNode, error)
+	GetSystemsForest(depth int, withChildCount bool) ([]*models.SystemTreeNode, error)
+	GetSystemMaintenance(filter models.MaintenanceFilter) (*models.MaintenancePage, error)
+	CreateSystemMaintenance(systemCode string, maintenance models.Maintenance) (models.Maintenance, error)
+	CreateMaintenancePlan(systemCode string, plan models.MaintenancePlan) (models.MaintenancePlan, error)
+	GetMaintenancePlans(systemCode string) ([]models.MaintenancePlan, error)
+	DeleteMaintenancePlan(systemCode string, planId string) (*models.ResponseMessage, error)
+	GetDueMaintenance(systemCode string, until time.Time) ([]models.MaintenancePlan, error)
+	FindMaintenancePlans(systemCode string, subtree bool, username string) ([]models.MaintenancePlan, error)
+	GetMaintenanceReport(systemCode string, from *time.Time, to *time.Time, period string, top int) (*models.MaintenanceReport, error)
+	DeleteConfigurationByKeyAndSystemCode(systemCode string, key string, username string) (*models.ResponseMessage, error)
+	GetSystemConfigurationBySystemCode(systemCode string) ([]models.Configuration, error)
+	GetConfigurationSchema(systemType string) ([]models.ConfigurationKeySchema, error)
+	SetConfigurationSchema(systemType string, keys []models.ConfigurationKeySchema) (*models.ResponseMessage, error)
+	GetSystemEffectiveConfiguration(systemCode string) ([]models.EffectiveConfiguration, error)
+	CompareSystemConfigurations(leftSystemCode string, rightSystemCode string) (*models.ConfigurationComparison, error)
+	CompareSubtreeConfigurations(leftSystemCode string, rightSystemCode string) (*models.SubtreeConfigurationComparison, error)
+	UpsertSystemConfiguration(systemCode string, entries []models.Configuration, username string) ([]models.ConfigurationChange, error)
+	GetSystemConfigurationRevisions(systemCode string) ([]models.ConfigurationRevision, error)
+	GetSystemConfigurationAt(systemCode string, revision *int64, at *time.Time) ([]models.Configuration, error)
+	DiffSystemConfigurationRevisions(systemCode string, fromRevision int64, toRevision int64) ([]models.ConfigurationChange, error)
+	RollbackSystemConfiguration(systemCode string, revision int64, username string) ([]models.ConfigurationChange, error)
+	RevealSystemConfigurationSecret(systemCode string, key string, username string) (models.Configuration, error)
+	GetConfigurationSecretAccesses(systemCode string, key string) ([]models.SecretAccess, error)
+	ApplyBulkConfiguration(request models.BulkConfigurationRequest, dryRun bool, username string) (*models.BulkConfigurationResult, error)
+	CreateConfigurationSnapshot(systemCode string, name string, username string) (*models.ConfigurationSnapshot, error)
+	GetConfigurationSnapshots(systemCode string) ([]models.ConfigurationSnapshot, error)
+	CompareConfigurationSnapshots(systemCode string, from string, to string) (*models.ConfigurationSnapshotComparison, error)
+	RestoreConfigurationSnapshot(systemCode string, name string, dryRun bool, username string) (*models.ConfigurationSnapshotRestoreResult, error)
+	GetSystemTimeValueLogs(systemCode string, from *time.Time, to *time.Time) ([]models.TimeValueLog, error)
+	GetSystemTimeValueLogsAggregated(systemCode string, from *time.Time, to *time.Time, aggregation models.TimeValueLogAggregation) ([]models.TimeValueLog, error)
+	GetSystemCodesWithTimeValueLogs(searchText string) ([]string, error)
+	GetSubsystemCodes(systemCode string) ([]string, error)
+	CreateSystemTimeValueLogs(systemCode string, logs []models.TimeValueLog) (*models.TimeValueLogIngestResult, error)
+	RecreateDatabaseData() (*models.ResponseMessage, error)
+	MigrateDatabaseData() error
+}
+
+func NewSystemsService(driver neo4j.Driver, timeValueBroadcaster ITimeValueBroadcaster, secretCipher *ConfigurationSecretCipher) ISystemsService {
+	return &SystemsService{
+		neo4jDriver:          driver,
+		timeValueBroadcaster: timeValueBroadcaster,
+		secretCipher:         secretCipher,
+	}
+}
+
+//Create new System. If parentSystemCode is specified, create also hierrarchical relationship to this parent System.
+func (svc *SystemsService) CreateNewSystem(system models.System) (*models.ResponseMessage, error) {
+
+	result := models.ResponseMessage{Message: "System was succesfuly created."}
+
+	session := svc.neo4jDriver.NewSession(neo4j.SessionConfig{})
+	defer session.Close()
+	_, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+
+		if system.ParentSystemCode == "" {
+			_, err := tx.Run(`CREATE (s:System { 
+			name: $name, 
+			code: $code,
+			type: $type
+			}) 
+		RETURN id(s)`, map[string]interface{}{
+				"name": system.Name,
+				"code": system.Code,
+				"type": system.Type,
+			})
+			if err != nil {
+				return nil, err
+			}
+			return nil, nil
+		} else {
+			_, err := tx.Run(`MATCH (parent:System{code:$parentCode})
+			CREATE (s:System {name: $name, code: $code, type: $type })
+			CREATE (parent)-[:HAS_SUBSYSTEM]->(s)`, map[string]interface{}{
+				"name":       system.Name,
+				"code":       system.Code,
+				"type":       system.Type,
+				"parentCode": system.ParentSystemCode,
+			})
+			if err != nil {
+				return nil, err
+			}
+			return nil, nil
+		}
+
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+//Update name and/or code of the System in place, so its relationships (subsystems, configuration, logs, maintenance) are kept.
+func (svc *SystemsService) UpdateSystem(systemCode string, update models.SystemUpdate) (models.System, error) {
+	session := svc.neo4jDriver.NewSession(neo4j.SessionConfig{})
+	defer session.Close()
+	record, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		//the System has to exist before the new code is checked for conflicts
+		reader, err := tx.Run(`MATCH (s:System{code: $code}) 
+		OPTIONAL MATCH (other:System{code: $newCode}) WHERE other <> s 
+		return s.code, count(other)`, map[string]interface{}{
+			"code":    systemCode,
+			"newCode": stringParam(update.Code),
+		})
+		if err != nil {
+			return nil, err
+		}
+		if !reader.Next() {
+			if err = reader.Err(); err != nil {
+				return nil, err
+			}
+			return nil, ErrSystemNotFound
+		}
+		if reader.Record().Values[1].(int64) > 0 {
+			return nil, ErrSystemCodeConflict
+		}
+
+		reader, err = tx.Run(`MATCH (s:System{code: $code}) 
+		SET s.name = coalesce($name, s.name), s.code = coalesce($newCode, s.code), s.type = coalesce($type, s.type) 
+		return s.code, s.name, coalesce(s.type, '')`, map[string]interface{}{
+			"code":    systemCode,
+			"name":    stringParam(update.Name),
+			"newCode": stringParam(update.Code),
+			"type":    stringParam(update.Type),
+		})
+		if err != nil {
+			return nil, err
+		}
+		if !reader.Next() {
+			if err = reader.Err(); err != nil {
+				return nil, err
+			}
+			return nil, ErrSystemNotFound
+		}
+
+		item := models.System{}
+		item.Code = reader.Record().Values[0].(string)
+		item.Name = reader.Record().Values[1].(string)
+		item.Type = reader.Record().Values[2].(string)
+
+		return item, nil
+	})
+
+	if err != nil {
+		if isConstraintViolation(err) {
+			return models.System{}, ErrSystemCodeConflict
+		}
+		return models.System{}, err
+	}
+
+	return record.(models.System), nil
+}
+
+//Move the System with its whole subtree under a new parent System, or make it a root System if parentSystemCode is empty.
+//Moves into the own subtree are refused. Every move is recorded in the move history of the System.
+func (svc *SystemsService) MoveSystem(systemCode string, parentSystemCode string, username string) (*models.ResponseMessage, error) {
+	result := models.ResponseMessage{Message: "System was succesfuly moved."}
+
+	session := svc.neo4jDriver.NewSession(neo4j.SessionConfig{})
+	defer session.Close()
+	_, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		reader, err := tx.Run(`MATCH (s:System{code: $code}) 
+		OPTIONAL MATCH (parent:System)-[:HAS_SUBSYSTEM]->(s) 
+		return parent.code`, map[string]interface{}{
+			"code": systemCode,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if !reader.Next() {
+			if err = reader.Err(); err != nil {
+				return nil, err
+			}
+			return nil, ErrSystemNotFound
+		}
+		oldParentSystemCode, _ := reader.Record().Values[0].(string)
+		if oldParentSystemCode == parentSystemCode {
+			return nil, nil
+		}
+
+		if parentSystemCode != "" {
+			reader, err = tx.Run(`MATCH (parent:System{code: $parentCode}) 
+			return exists((:System{code: $code})-[:HAS_SUBSYSTEM*0..]->(parent))`, map[string]interface{}{
+				"code":       systemCode,
+				"parentCode": parentSystemCode,
+			})
+			if err != nil {
+				return nil, err
+			}
+			if !reader.Next() {
+				if err = reader.Err(); err != nil {
+					return nil, err
+				}
+				return nil, ErrParentSystemNotFound
+			}
+			if reader.Record().Values[0].(bool) {
+				return nil, ErrSystemHierarchyCycle
+			}
+		}
+
+		_, err = tx.Run(`MATCH (s:System{code: $code}) 
+		OPTIONAL MATCH (:System)-[r:HAS_SUBSYSTEM]->(s) 
+		DELETE r 
+		WITH distinct s 
+		OPTIONAL MATCH (parent:System{code: $parentCode}) 
+		FOREACH (p IN CASE WHEN parent IS NULL THEN [] ELSE [parent] END | CREATE (p)-[:HAS_SUBSYSTEM]->(s)) 
+		CREATE (s)-[:WAS_MOVED]->(:SystemMove{date: datetime(), fromParentCode: $oldParentCode, toParentCode: $parentCode, username: $username})`, map[string]interface{}{
+			"code":          systemCode,
+			"parentCode":    parentSystemCode,
+			"oldParentCode": oldParentSystemCode,
+			"username":      username,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (svc *SystemsService) GetSystemMoveHistory(systemCode string) ([]models.SystemMove, error) {
+	session := svc.neo4jDriver.NewSession(neo4j.SessionConfig{})
+	defer session.Close()
+	records, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		if err := checkSystemExists(tx, systemCode); err != nil {
+			return nil, err
+		}
+
+		reader, err := tx.Run(`MATCH (s:System{code: $code})-[:WAS_MOVED]->(m:SystemMove) 
+		RETURN m.date, m.fromParentCode, m.toParentCode, m.username order by m.date`, map[string]interface{}{
+			"code": systemCode,
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		list := make([]models.SystemMove, 0)
+
+		for reader.Next() {
+			list = append(list, models.SystemMove{When: reader.Record().Values[0].(time.Time), FromParentSystemCode: reader.Record().Values[1].(string), ToParentSystemCode: reader.Record().Values[2].(string), Username: reader.Record().Values[3].(string)})
+		}
+		if err = reader.Err(); err != nil {
+			return nil, err
+		}
+
+		return list, nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return records.([]models.SystemMove), nil
+}
+
+//Delete the System with its configuration, logs and history. Subsystems are handled by the mode, in dry run nothing is deleted.
+func (svc *SystemsService) DeleteSystemByCode(systemCode string, mode string, dryRun bool) (*models.SystemDeleteResult, error) {
+	session := svc.neo4jDriver.NewSession(neo4j.SessionConfig{})
+	defer session.Close()
+	result, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		result := models.SystemDeleteResult{Mode: mode, DryRun: dryRun, ReattachedSystems: make([]string, 0)}
+
+		reader, err := tx.Run(`MATCH (s:System{code: $code}) 
+		OPTIONAL MATCH (parent:System)-[:HAS_SUBSYSTEM]->(s) 
+		RETURN parent.code, [(s)-[:HAS_SUBSYSTEM]->(child:System) | child.code]`, map[string]interface{}{
+			"code": systemCode,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if !reader.Next() {
+			if err = reader.Err(); err != nil {
+				return nil, err
+			}
+			return nil, ErrSystemNotFound
+		}
+		parentCode, _ := reader.Record().Values[0].(string)
+		children := reader.Record().Values[1].([]interface{})
+
+		switch mode {
+		case DeleteModeRestrict:
+			if len(children) > 0 {
+				return nil, ErrSystemHasSubsystems
+			}
+			result.DeletedSystems = []string{systemCode}
+		case DeleteModeReattach:
+			for _, child := range children {
+				result.ReattachedSystems = append(result.ReattachedSystems, child.(string))
+			}
+			result.NewParentSystemCode = parentCode
+			result.DeletedSystems = []string{systemCode}
+		case DeleteModeCascade:
+			reader, err = tx.Run(`MATCH (s:System{code: $code})-[:HAS_SUBSYSTEM*0..]->(sub:System) RETURN collect(sub.code)`, map[string]interface{}{
+				"code": systemCode,
+			})
+			if err != nil {
+				return nil, err
+			}
+			rec, err := reader.Single()
+			if err != nil {
+				return nil, err
+			}
+			result.DeletedSystems = make([]string, 0)
+			for _, code := range rec.Values[0].([]interface{}) {
+				result.DeletedSystems = append(result.DeletedSystems, code.(string))
+			}
+		default:
+			return nil, errors.New("Unknown delete mode: " + mode)
+		}
+
+		reader, err = tx.Run(`MATCH (s:System) WHERE s.code IN $codes 
+		RETURN sum(size([(s)-[:HAS]->(c:Config) | c])), sum(size([(s)-[:LOG]->(l:TimeValue) | l])), sum(size([(s)-[m:WAS_MAINTAINED_BY]->() | m]))`, map[string]interface{}{
+			"codes": result.DeletedSystems,
+		})
+		if err != nil {
+			return nil, err
+		}
+		rec, err := reader.Single()
+		if err != nil {
+			return nil, err
+		}
+		result.DeletedConfigurations = rec.Values[0].(int64)
+		result.DeletedTimeValueLogs = rec.Values[1].(int64)
+		result.DeletedMaintenance = rec.Values[2].(int64)
+
+		if dryRun {
+			return &result, nil
+		}
+
+		if mode == DeleteModeReattach && parentCode != "" {
+			_, err = tx.Run(`MATCH (parent:System{code: $parentCode})-[:HAS_SUBSYSTEM]->(s:System{code: $code})-[:HAS_SUBSYSTEM]->(child:System) 
+			CREATE (parent)-[:HAS_SUBSYSTEM]->(child)`, map[string]interface{}{
+				"code":       systemCode,
+				"parentCode": parentCode,
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		_, err = tx.Run(`MATCH (s:System)-[:`+systemOwnedNodesRelationships+`]->(owned) WHERE s.code IN $codes AND NOT owned:System 
+		DETACH DELETE owned`, map[string]interface{}{
+			"codes": result.DeletedSystems,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = tx.Run(`MATCH (s:System) WHERE s.code IN $codes 
+		DETACH DELETE s`, map[string]interface{}{
+			"codes": result.DeletedSystems,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return &result, nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result.(*models.SystemDeleteResult), nil
+}
+
+func (svc *SystemsService) GetSystemByCode(systemCode string) (models.System, error) {
+
+	session := svc.neo4jDriver.NewSession(neo4j.SessionConfig{})
+	defer session.Close()
+	record, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		reader, err := tx.Run(`MATCH (s:System{code: $code}) return s.code, s.name, coalesce(s.type, '')`, map[string]interface{}{
+			"code": systemCode,
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		item := models.System{}
+		rec, err := reader.Single()
+
+		if err != nil {
+			return nil, err
+		}
+		item.Code = rec.Values[0].(string)
+		item.Name = rec.Values[1].(string)
+		item.Type = rec.Values[2].(string)
+
+		return item, nil
+	})
+
+	if err != nil {
+		return models.System{}, err
+	}
+
+	return record.(models.System), nil
 }
 
-type ISystemsService interface {
-	CreateNewSystem(system models.System) (*models.ResponseMessage, error)
-	DeleteSystemByCode(systemCode string) (*models.ResponseMessage, error)
-	GetSystemByCode(systemCode string) (models.System, error)
-	GetSystemsByNameOrCode(searchText string, limit int32) ([]models.System, error)
-	GetSystemMaintenance(systemCode string) ([]models.Maintenance, error)
-	DeleteConfigurationByKeyAndSystemCode(systemCode string, key string) (*models.ResponseMessage, error)
-	GetSystemConfigurationBySystemCode(systemCode string) ([]models.Configuration, error)
-	GetSystemTimeValueLogs(systemCode string) ([]models.TimeValueLog, error)
-	RecreateDatabaseData() (*models.ResponseMessage, error)
-}
+func (svc *SystemsService) GetSystemsByNameOrCode(searchText string, limit int32) ([]models.System, error) {
+
+	session := svc.neo4jDriver.NewSession(neo4j.SessionConfig{})
+	defer session.Close()
+	records, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		reader, err := tx.Run(`call {
+			match(s:System) where ($searchText = '' or ((toLower(s.name) CONTAINS $searchText) or (toLower(s.code) CONTAINS $searchText))) and (not (s)<-[:HAS_SUBSYSTEM]-()) 
+			return s.name as name , s.code as code, '' as parent
+			union
+			match(s:System)<-[r:HAS_SUBSYSTEM]-(parent:System) where $searchText = '' or ((toLower(s.name) CONTAINS $searchText) or (toLower(s.code) CONTAINS $searchText)) 
+			return s.name as name, s.code as code, parent.name as parent 
+			}
+			return name, code, parent
+			limit $limit`, map[string]interface{}{
+			"searchText": searchText,
+			"limit":      limit,
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		list := make([]models.System, 0)
+
+		for reader.Next() {
+			list = append(list, models.System{Name: reader.Record().Values[0].(string), Code: reader.Record().Values[1].(string), ParentSystemCode: reader.Record().Values[2].(string)})
+		}
+		if err = reader.Err(); err != nil {
+			return nil, err
+		}
+
+		return list, nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return records.([]models.System), nil
+}
+
+//Get the ancestors of the System ordered from its root System to its parent System
+func (svc *SystemsService) GetSystemAncestors(systemCode string) ([]models.System, error) {
+	session := svc.neo4jDriver.NewSession(neo4j.SessionConfig{})
+	defer session.Close()
+	records, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		reader, err := tx.Run(`MATCH p=(root:System)-[:HAS_SUBSYSTEM*0..]->(s:System{code: $code}) 
+		WHERE NOT exists( ()-[:HAS_SUBSYSTEM]->(root)) 
+		RETURN [n IN nodes(p) | n.code], [n IN nodes(p) | n.name]`, map[string]interface{}{
+			"code": systemCode,
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !reader.Next() {
+			if err = reader.Err(); err != nil {
+				return nil, err
+			}
+			return nil, ErrSystemNotFound
+		}
+
+		codes := reader.Record().Values[0].([]interface{})
+		names := reader.Record().Values[1].([]interface{})
+		list := make([]models.System, 0, len(codes)-1)
+		parentCode := ""
+		for i := 0; i < len(codes)-1; i++ {
+			list = append(list, models.System{Code: codes[i].(string), Name: names[i].(string), ParentSystemCode: parentCode})
+			parentCode = codes[i].(string)
+		}
+
+		return list, nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return records.([]models.System), nil
+}
+
+//Get the System with its subsystems nested up to the depth (negative depth is unlimited)
+func (svc *SystemsService) GetSystemTree(systemCode string, depth int, withChildCount bool) (*models.SystemTreeNode, error) {
+	roots, err := svc.getSystemTrees(systemCode, depth, withChildCount)
+	if err != nil {
+		return nil, err
+	}
+	if len(roots) == 0 {
+		return nil, ErrSystemNotFound
+	}
+	return roots[0], nil
+}
+
+//Get all root Systems (without a parent System) with their subsystems nested up to the depth (negative depth is unlimited)
+func (svc *SystemsService) GetSystemsForest(depth int, withChildCount bool) ([]*models.SystemTreeNode, error) {
+	return svc.getSystemTrees("", depth, withChildCount)
+}
+
+//Load the subtrees of the System, or of all root Systems if systemCode is empty, and nest the subsystems to their parents
+func (svc *SystemsService) getSystemTrees(systemCode string, depth int, withChildCount bool) ([]*models.SystemTreeNode, error) {
+	//variable length relationship bounds cannot be parameters
+	depthRange := "0.."
+	if depth >= 0 {
+		depthRange += strconv.Itoa(depth)
+	}
+
+	session := svc.neo4jDriver.NewSession(neo4j.SessionConfig{})
+	defer session.Close()
+	records, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		reader, err := tx.Run(`MATCH (root:System) 
+		WHERE ($code = '' AND NOT exists( ()-[:HAS_SUBSYSTEM]->(root))) OR root.code = $code 
+		MATCH p=(root)-[:HAS_SUBSYSTEM*`+depthRange+`]->(s:System) 
+		RETURN s.code, s.name, CASE WHEN length(p) = 0 THEN '' ELSE nodes(p)[-2].code END, size((s)-[:HAS_SUBSYSTEM]->()) 
+		ORDER BY length(p), root.code, s.code`, map[string]interface{}{
+			"code": systemCode,
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		roots := make([]*models.SystemTreeNode, 0)
+		nodes := make(map[string]*models.SystemTreeNode)
+
+		for reader.Next() {
+			values := reader.Record().Values
+			node := &models.SystemTreeNode{Code: values[0].(string), Name: values[1].(string), Subsystems: make([]*models.SystemTreeNode, 0)}
+			if withChildCount {
+				childCount := int(values[3].(int64))
+				node.ChildCount = &childCount
+			}
+			nodes[node.Code] = node
+
+			//parents are always loaded before their subsystems thanks to the order by path length
+			if parent, ok := nodes[values[2].(string)]; ok {
+				parent.Subsystems = append(parent.Subsystems, node)
+			} else {
+				roots = append(roots, node)
+			}
+		}
+		if err = reader.Err(); err != nil {
+			return nil, err
+		}
+
+		return roots, nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return records.([]*models.SystemTreeNode), nil
+}
+
+//Get the page of the maintenance matching the filter ordered by date, with the total count of the matching maintenance
+func (svc *SystemsService) GetSystemMaintenance(filter models.MaintenanceFilter) (*models.MaintenancePage, error) {
+	session := svc.neo4jDriver.NewSession(neo4j.SessionConfig{})
+	defer session.Close()
+	records, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		return readMaintenancePage(tx, filter)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return records.(*models.MaintenancePage), nil
+}
+
+//Log the maintenance event of the System performed by the existing User
+func (svc *SystemsService) CreateSystemMaintenance(systemCode string, maintenance models.Maintenance) (models.Maintenance, error) {
+	session := svc.neo4jDriver.NewSession(neo4j.SessionConfig{})
+	defer session.Close()
+	result, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		if err := checkSystemExists(tx, systemCode); err != nil {
+			return nil, err
+		}
+		//Users are created by the users admin only, deactivated Users cannot maintain anymore
+		user, err := readUser(tx, `MATCH (u:User{username: $value})`, maintenance.Username)
+		if err != nil {
+			return nil, err
+		}
+		if !user.Active {
+			return nil, ErrUserInactive
+		}
+
+		reader, err := tx.Run(`MATCH (s:System{code: $systemCode}), (u:User{username: $username}) 
+		CREATE (s)-[m:WAS_MAINTAINED_BY{id: randomUUID(), date: $date, type: $type, description: $description, duration: $duration}]->(u) 
+		RETURN m.date, u.username, s.name, s.code, m.id, m.type, m.description, m.duration`, map[string]interface{}{
+			"systemCode":  systemCode,
+			"username":    maintenance.Username,
+			"date":        maintenance.When,
+			"type":        maintenance.Type,
+			"description": maintenance.Description,
+			"duration":    maintenance.Duration,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if !reader.Next() {
+			if err = reader.Err(); err != nil {
+				return nil, err
+			}
+			return nil, ErrSystemNotFound
+		}
+
+		return maintenanceFromRecord(reader.Record()), nil
+	})
+
+	if err != nil {
+		return models.Maintenance{}, err
+	}
+
+	return result.(models.Maintenance), nil
+}
+
+//Create the maintenance plan of the System, returned with its next due date
+func (svc *SystemsService) CreateMaintenancePlan(systemCode string, plan models.MaintenancePlan) (models.MaintenancePlan, error) {
+	if err := validateMaintenancePlan(plan); err != nil {
+		return models.MaintenancePlan{}, err
+	}
+
+	session := svc.neo4jDriver.NewSession(neo4j.SessionConfig{})
+	defer session.Close()
+	result, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		if err := checkSystemExists(tx, systemCode); err != nil {
+			return nil, err
+		}
+		//the technician of the plan is an active User
+		if plan.Username != "" {
+			user, err := readUser(tx, `MATCH (u:User{username: $value})`, plan.Username)
+			if errors.Is(err, ErrUserNotFound) {
+				return nil, fmt.Errorf("%w: user %s not found", ErrInvalidMaintenancePlan, plan.Username)
+			}
+			if err != nil {
+				return nil, err
+			}
+			if !user.Active {
+				return nil, fmt.Errorf("%w: user %s is not active", ErrInvalidMaintenancePlan, plan.Username)
+			}
+		}
+
+		reader, err := tx.Run(`MATCH (s:System{code: $systemCode}) 
+		CREATE (s)-[:HAS_MAINTENANCE_PLAN]->(p:MaintenancePlan{id: randomUUID(), name: $name, type: $type, description: $description, 
+		username: $username, frequency: $frequency, interval: $interval, rrule: $rrule, start: $start}) 
+		RETURN p.id`, map[string]interface{}{
+			"systemCode":  systemCode,
+			"name":        plan.Name,
+			"type":        plan.Type,
+			"description": plan.Description,
+			"username":    plan.Username,
+			"frequency":   plan.Frequency,
+			"interval":    plan.Interval,
+			"rrule":       plan.RRule,
+			"start":       plan.Start,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if !reader.Next() {
+			if err = reader.Err(); err != nil {
+				return nil, err
+			}
+			return nil, ErrSystemNotFound
+		}
+		planId := reader.Record().Values[0].(string)
+
+		plans, err := readMaintenancePlans(tx, systemCode, false, "")
+		if err != nil {
+			return nil, err
+		}
+		for _, created := range plans {
+			if created.Id == planId {
+				return created, nil
+			}
+		}
+		return nil, ErrMaintenancePlanNotFound
+	})
+
+	if err != nil {
+		return models.MaintenancePlan{}, err
+	}
+
+	return result.(models.MaintenancePlan), nil
+}
+
+//Get the maintenance plans of the System ordered by name
+func (svc *SystemsService) GetMaintenancePlans(systemCode string) ([]models.MaintenancePlan, error) {
+	session := svc.neo4jDriver.NewSession(neo4j.SessionConfig{})
+	defer session.Close()
+	records, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		return readMaintenancePlans(tx, systemCode, false, "")
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return records.([]models.MaintenancePlan), nil
+}
+
+func (svc *SystemsService) DeleteMaintenancePlan(systemCode string, planId string) (*models.ResponseMessage, error) {
+	result := models.ResponseMessage{Message: "Maintenance plan was succesfuly deleted."}
+
+	session := svc.neo4jDriver.NewSession(neo4j.SessionConfig{})
+	defer session.Close()
+	_, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		reader, err := tx.Run(`MATCH (s:System{code: $systemCode})-[:HAS_MAINTENANCE_PLAN]->(p:MaintenancePlan{id: $planId}) 
+		DETACH DELETE p RETURN count(p)`, map[string]interface{}{
+			"systemCode": systemCode,
+			"planId":     planId,
+		})
+		if err != nil {
+			return nil, err
+		}
+		record, err := reader.Single()
+		if err != nil {
+			return nil, err
+		}
+		if record.Values[0].(int64) == 0 {
+			return nil, ErrMaintenancePlanNotFound
+		}
+		return nil, nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+//Get the planned maintenance of the System subtree which is overdue or due until the time, ordered by the due date.
+//All Systems are included if the System code is empty.
+func (svc *SystemsService) GetDueMaintenance(systemCode string, until time.Time) ([]models.MaintenancePlan, error) {
+	session := svc.neo4jDriver.NewSession(neo4j.SessionConfig{})
+	defer session.Close()
+	records, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		plans, err := readMaintenancePlans(tx, systemCode, true, "")
+		if err != nil {
+			return nil, err
+		}
+
+		list := make([]models.MaintenancePlan, 0)
+		for _, plan := range plans {
+			if plan.NextDue != nil && !plan.NextDue.After(until) {
+				list = append(list, plan)
+			}
+		}
+		sort.SliceStable(list, func(i, j int) bool {
+			return list[i].NextDue.Before(*list[j].NextDue)
+		})
+		return list, nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return records.([]models.MaintenancePlan), nil
+}
+
+//Get the maintenance plans of the System or its subtree and of the technician, empty System code and username do not filter
+func (svc *SystemsService) FindMaintenancePlans(systemCode string, subtree bool, username string) ([]models.MaintenancePlan, error) {
+	session := svc.neo4jDriver.NewSession(neo4j.SessionConfig{})
+	defer session.Close()
+	records, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		return readMaintenancePlans(tx, systemCode, subtree, username)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return records.([]models.MaintenancePlan), nil
+}
+
+//Get the maintenance statistics of every System in the subtree and rolled up for the whole subtree, ordered by System code.
+//Counts are per period, top is the number of the most active technicians.
+func (svc *SystemsService) GetMaintenanceReport(systemCode string, from *time.Time, to *time.Time, period string, top int) (*models.MaintenanceReport, error) {
+	//the subtree and its maintenance are read in one transaction, so a concurrent move cannot mix them
+	var systems []models.System
+	var maintenance *models.MaintenancePage
+	session := svc.neo4jDriver.NewSession(neo4j.SessionConfig{})
+	defer session.Close()
+	_, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		reader, err := tx.Run(`MATCH (root:System{code: $systemCode})-[:HAS_SUBSYSTEM*0..]->(s:System) 
+		RETURN s.code, s.name, coalesce(s.type, '') ORDER BY s.code`, map[string]interface{}{
+			"systemCode": systemCode,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		systems = make([]models.System, 0)
+		for reader.Next() {
+			systems = append(systems, models.System{Code: reader.Record().Values[0].(string), Name: reader.Record().Values[1].(string), Type: reader.Record().Values[2].(string)})
+		}
+		if err = reader.Err(); err != nil {
+			return nil, err
+		}
+		if len(systems) == 0 {
+			return nil, ErrSystemNotFound
+		}
+
+		maintenance, err = readMaintenancePage(tx, models.MaintenanceFilter{SystemCode: systemCode, Subtree: true, From: from, To: to})
+		return nil, err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	maintenanceBySystem := make(map[string][]models.Maintenance)
+	for _, m := range maintenance.Items {
+		maintenanceBySystem[m.SystemCode] = append(maintenanceBySystem[m.SystemCode], m)
+	}
+
+	report := models.MaintenanceReport{Period: period, From: from, To: to, Types: make([]models.MaintenanceStatistics, 0), Systems: make([]models.MaintenanceStatistics, 0, len(systems))}
+	systemTypes := make(map[string]bool)
+	for _, system := range systems {
+		statistics := models.MaintenanceStatistics{SystemCode: system.Code, SystemName: system.Name, SystemType: system.Type}
+		computeMaintenanceStatistics(&statistics, maintenanceBySystem[system.Code], period, top)
+		report.Systems = append(report.Systems, statistics)
+		if system.Code == systemCode {
+			report.Subtree = models.MaintenanceStatistics{SystemCode: system.Code, SystemName: system.Name, SystemType: system.Type}
+		}
+		if system.Type != "" {
+			systemTypes[system.Type] = true
+		}
+	}
+	computeMaintenanceStatistics(&report.Subtree, maintenance.Items, period, top)
+
+	//Systems without type are only in the subtree statistics
+	for systemType := range systemTypes {
+		typeMaintenance := make([]models.Maintenance, 0)
+		for _, system := range systems {
+			if system.Type == systemType {
+				typeMaintenance = append(typeMaintenance, maintenanceBySystem[system.Code]...)
+			}
+		}
+		sort.SliceStable(typeMaintenance, func(i, j int) bool { return typeMaintenance[i].When.Before(typeMaintenance[j].When) })
+		statistics := models.MaintenanceStatistics{SystemType: systemType}
+		computeMaintenanceStatistics(&statistics, typeMaintenance, period, top)
+		report.Types = append(report.Types, statistics)
+	}
+	sort.Slice(report.Types, func(i, j int) bool { return report.Types[i].SystemType < report.Types[j].SystemType })
+
+	return &report, nil
+}
+
+func (svc *SystemsService) DeleteConfigurationByKeyAndSystemCode(systemCode string, key string, username string) (*models.ResponseMessage, error) {
+	result := models.ResponseMessage{Message: "Configuration was succesfuly deleted."}
+
+	session := svc.neo4jDriver.NewSession(neo4j.SessionConfig{})
+	defer session.Close()
+	_, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		if err := lockSystemConfiguration(tx, systemCode); err != nil {
+			return nil, err
+		}
+		current, err := readSystemConfiguration(tx, systemCode)
+		if err != nil {
+			return nil, err
+		}
+		oldValue, ok := current[key]
+		if !ok {
+			return nil, nil
+		}
+		changes := []models.ConfigurationChange{{Key: key, OldValue: &oldValue, Action: "deleted"}}
+		return nil, writeSystemConfigurationChanges(tx, systemCode, changes, username)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+//Get the configuration of the System, secret values are masked
+func (svc *SystemsService) GetSystemConfigurationBySystemCode(systemCode string) ([]models.Configuration, error) {
+	list, err := svc.getSystemConfiguration(systemCode)
+	if err != nil {
+		return nil, err
+	}
+	return maskConfiguration(list), nil
+}
+
+//Get the configuration of the System with the secret values as they are stored
+func (svc *SystemsService) getSystemConfiguration(systemCode string) ([]models.Configuration, error) {
+	session := svc.neo4jDriver.NewSession(neo4j.SessionConfig{})
+	defer session.Close()
+	records, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		reader, err := tx.Run(`match(s:System{code: $systemCode})-[]->(c:Config) return c.key, c.value`, map[string]interface{}{
+			"systemCode": systemCode,
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		list := make([]models.Configuration, 0)
+
+		for reader.Next() {
+			list = append(list, models.Configuration{Key: reader.Record().Values[0].(string), Value: reader.Record().Values[1].(string)})
+		}
+		if err = reader.Err(); err != nil {
+			return nil, err
+		}
+
+		schemas, err := readSystemConfigurationSchema(tx, systemCode)
+		if err != nil {
+			return nil, err
+		}
+
+		return typeConfiguration(schemas, list), nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return records.([]models.Configuration), nil
+}
+
+//Get the configuration schema of the System type ordered by key
+func (svc *SystemsService) GetConfigurationSchema(systemType string) ([]models.ConfigurationKeySchema, error) {
+	session := svc.neo4jDriver.NewSession(neo4j.SessionConfig{})
+	defer session.Close()
+	records, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		reader, err := tx.Run(`MATCH (schema:ConfigSchema{systemType: $systemType}) 
+		RETURN schema.key, schema.type, schema.min, schema.max, schema.values, schema.unit, schema.description order by schema.key`, map[string]interface{}{
+			"systemType": systemType,
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		list := make([]models.ConfigurationKeySchema, 0)
+
+		for reader.Next() {
+			list = append(list, configurationKeySchemaFromRecord(reader.Record()))
+		}
+		if err = reader.Err(); err != nil {
+			return nil, err
+		}
+
+		return list, nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return records.([]models.ConfigurationKeySchema), nil
+}
+
+//Replace the configuration schema of the System type. Already stored values are not validated, only the next writes are.
+func (svc *SystemsService) SetConfigurationSchema(systemType string, keys []models.ConfigurationKeySchema) (*models.ResponseMessage, error) {
+	if err := validateConfigurationSchema(keys); err != nil {
+		return nil, err
+	}
+
+	result := models.ResponseMessage{Message: "Configuration schema was succesfuly saved."}
+
+	schemas := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		schemas = append(schemas, map[string]interface{}{
+			"key":         key.Key,
+			"type":        key.Type,
+			"min":         floatParam(key.Min),
+			"max":         floatParam(key.Max),
+			"values":      key.Values,
+			"unit":        key.Unit,
+			"description": key.Description,
+		})
+	}
+
+	session := svc.neo4jDriver.NewSession(neo4j.SessionConfig{})
+	defer session.Close()
+	_, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		_, err := tx.Run(`MATCH (schema:ConfigSchema{systemType: $systemType}) DELETE schema`, map[string]interface{}{
+			"systemType": systemType,
+		})
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.Run(`UNWIND $schemas AS schema 
+		CREATE (:ConfigSchema{systemType: $systemType, key: schema.key, type: schema.type, min: schema.min, max: schema.max, 
+		values: schema.values, unit: schema.unit, description: schema.description})`, map[string]interface{}{
+			"systemType": systemType,
+			"schemas":    schemas,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+//Get the configuration of the System merged with the configuration of all its ancestors. For every key the value
+//of the nearest System wins, so the own configuration overrides the inherited one.
+func (svc *SystemsService) GetSystemEffectiveConfiguration(systemCode string) ([]models.EffectiveConfiguration, error) {
+	session := svc.neo4jDriver.NewSession(neo4j.SessionConfig{})
+	defer session.Close()
+	records, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		reader, err := tx.Run(`MATCH p=(ancestor:System)-[:HAS_SUBSYSTEM*0..]->(s:System{code: $systemCode}) 
+		OPTIONAL MATCH (ancestor)-[:HAS]->(c:Config) 
+		RETURN ancestor.code, c.key, c.value ORDER BY length(p), c.key`, map[string]interface{}{
+			"systemCode": systemCode,
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		list := make([]models.EffectiveConfiguration, 0)
+		keys := make(map[string]bool)
+		found := false
+
+		//rows are ordered from the System itself to its root, so the first value of the key is the nearest one
+		for reader.Next() {
+			found = true
+			key, ok := reader.Record().Values[1].(string)
+			if !ok || keys[key] {
+				continue
+			}
+			keys[key] = true
+			sourceSystemCode := reader.Record().Values[0].(string)
+			entry := models.EffectiveConfiguration{Key: key, Value: reader.Record().Values[2].(string), SourceSystemCode: sourceSystemCode, Inherited: sourceSystemCode != systemCode}
+			if isSecretConfigurationValue(entry.Value) {
+				entry.Secret = true
+				entry.Value = MaskedConfigurationValue
+			}
+			list = append(list, entry)
+		}
+		if err = reader.Err(); err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, ErrSystemNotFound
+		}
+
+		sort.Slice(list, func(i, j int) bool {
+			return list[i].Key < list[j].Key
+		})
+
+		return list, nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return records.([]models.EffectiveConfiguration), nil
+}
+
+//Compare the configuration of two Systems
+func (svc *SystemsService) CompareSystemConfigurations(leftSystemCode string, rightSystemCode string) (*models.ConfigurationComparison, error) {
+	for _, systemCode := range []string{leftSystemCode, rightSystemCode} {
+		if _, err := svc.GetSystemTree(systemCode, 0, false); err != nil {
+			return nil, err
+		}
+	}
+
+	comparison, err := svc.compareSystemConfigurations("", leftSystemCode, rightSystemCode)
+	if err != nil {
+		return nil, err
+	}
+	return &comparison, nil
+}
+
+//Compare the configuration of all Systems of two subtrees matched by the path of their names relative to the subtree roots.
+//Systems without a match in the other subtree are reported by their path.
+func (svc *SystemsService) CompareSubtreeConfigurations(leftSystemCode string, rightSystemCode string) (*models.SubtreeConfigurationComparison, error) {
+	leftTree, err := svc.GetSystemTree(leftSystemCode, -1, false)
+	if err != nil {
+		return nil, err
+	}
+	rightTree, err := svc.GetSystemTree(rightSystemCode, -1, false)
+	if err != nil {
+		return nil, err
+	}
+	leftPaths := make(map[string]string)
+	if err = relativeSystemPaths(leftTree, "", leftPaths); err != nil {
+		return nil, err
+	}
+	rightPaths := make(map[string]string)
+	if err = relativeSystemPaths(rightTree, "", rightPaths); err != nil {
+		return nil, err
+	}
+
+	result := models.SubtreeConfigurationComparison{
+		Comparisons:      make([]models.ConfigurationComparison, 0),
+		OnlyLeftSystems:  make([]string, 0),
+		OnlyRightSystems: make([]string, 0),
+	}
+	for path, leftCode := range leftPaths {
+		rightCode, ok := rightPaths[path]
+		if !ok {
+			result.OnlyLeftSystems = append(result.OnlyLeftSystems, path)
+			continue
+		}
+		comparison, err := svc.compareSystemConfigurations(path, leftCode, rightCode)
+		if err != nil {
+			return nil, err
+		}
+		result.Comparisons = append(result.Comparisons, comparison)
+	}
+	for path := range rightPaths {
+		if _, ok := leftPaths[path]; !ok {
+			result.OnlyRightSystems = append(result.OnlyRightSystems, path)
+		}
+	}
+
+	sort.Slice(result.Comparisons, func(i, j int) bool { return result.Comparisons[i].Path < result.Comparisons[j].Path })
+	sort.Strings(result.OnlyLeftSystems)
+	sort.Strings(result.OnlyRightSystems)
+
+	return &result, nil
+}
+
+//Secret values are not decrypted, compareConfigurations never compares them
+func (svc *SystemsService) compareSystemConfigurations(path string, leftSystemCode string, rightSystemCode string) (models.ConfigurationComparison, error) {
+	left, err := svc.getSystemConfiguration(leftSystemCode)
+	if err != nil {
+		return models.ConfigurationComparison{}, err
+	}
+	right, err := svc.getSystemConfiguration(rightSystemCode)
+	if err != nil {
+		return models.ConfigurationComparison{}, err
+	}
+
+	comparison := compareConfigurations(left, right)
+	comparison.Path = path
+	comparison.LeftSystemCode = leftSystemCode
+	comparison.RightSystemCode = rightSystemCode
+	return comparison, nil
+}
+
+//Create or update the configuration entries of the System, there is always only one Config node per key and System.
+//Returns the change of every entry, the changes are recorded as a new configuration revision.
+func (svc *SystemsService) UpsertSystemConfiguration(systemCode string, entries []models.Configuration, username string) ([]models.ConfigurationChange, error) {
+	session := svc.neo4jDriver.NewSession(neo4j.SessionConfig{})
+	defer session.Close()
+	records, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		if err := lockSystemConfiguration(tx, systemCode); err != nil {
+			return nil, err
+		}
+		current, err := readSystemConfiguration(tx, systemCode)
+		if err != nil {
+			return nil, err
+		}
+
+		changes, err := svc.configurationEntriesChanges(tx, systemCode, current, entries)
+		if err != nil {
+			return nil, err
+		}
+
+		err = writeSystemConfigurationChanges(tx, systemCode, changes, username)
+		if err != nil {
+			return nil, err
+		}
+
+		return maskConfigurationChanges(changes), nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return records.([]models.ConfigurationChange), nil
+}
+
+//Changes setting the entries to the current configuration. The values are validated before the secret ones are encrypted,
+//an entry stays secret when its current value is secret.
+func (svc *SystemsService) configurationEntriesChanges(tx neo4j.Transaction, systemCode string, current map[string]string, entries []models.Configuration) ([]models.ConfigurationChange, error) {
+	changes := make([]models.ConfigurationChange, 0, len(entries))
+	secret := make([]bool, 0, len(entries))
+	errs := make([]string, 0)
+	for _, entry := range entries {
+		if isSecretConfigurationValue(entry.Value) {
+			errs = append(errs, entry.Key+": value must not start with "+secretConfigurationValuePrefix)
+			continue
+		}
+		newValue := entry.Value
+		change := models.ConfigurationChange{Key: entry.Key, NewValue: &newValue, Action: "created"}
+		isSecret := entry.Secret
+		if oldValue, ok := current[entry.Key]; ok {
+			change.OldValue = &oldValue
+			change.Action = "updated"
+			//written secret values are always updated, the submitted value is never compared with the secret one
+			if isSecretConfigurationValue(oldValue) {
+				isSecret = true
+			} else if oldValue == newValue && !isSecret {
+				change.NewValue = change.OldValue
+				change.Action = "unchanged"
+			}
+		}
+		changes = append(changes, change)
+		secret = append(secret, isSecret)
+	}
+	if len(errs) > 0 {
+		return nil, &ConfigurationValidationError{Errors: errs}
+	}
+
+	if err := validateSystemConfigurationChanges(tx, systemCode, changes, svc.secretCipher); err != nil {
+		return nil, err
+	}
+
+	for i := range changes {
+		if !secret[i] || changes[i].Action == "unchanged" {
+			continue
+		}
+		encrypted, err := svc.secretCipher.encrypt(*changes[i].NewValue)
+		if err != nil {
+			return nil, err
+		}
+		changes[i].NewValue = &encrypted
+	}
+	return changes, nil
+}
+
+//Get all configuration revisions of the System ordered from the oldest one
+func (svc *SystemsService) GetSystemConfigurationRevisions(systemCode string) ([]models.ConfigurationRevision, error) {
+	session := svc.neo4jDriver.NewSession(neo4j.SessionConfig{})
+	defer session.Close()
+	records, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		if _, err := readSystemConfiguration(tx, systemCode); err != nil {
+			return nil, err
+		}
+		revisions, err := readSystemConfigurationRevisions(tx, systemCode)
+		if err != nil {
+			return nil, err
+		}
+		return maskConfigurationRevisions(revisions), nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return records.([]models.ConfigurationRevision), nil
+}
+
+//Get the configuration of the System as it was after the revision, or at the time if revision is nil.
+//Revision 0 is the configuration before the first recorded revision.
+func (svc *SystemsService) GetSystemConfigurationAt(systemCode string, revision *int64, at *time.Time) ([]models.Configuration, error) {
+	session := svc.neo4jDriver.NewSession(neo4j.SessionConfig{})
+	defer session.Close()
+	records, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		current, err := readSystemConfiguration(tx, systemCode)
+		if err != nil {
+			return nil, err
+		}
+		revisions, err := readSystemConfigurationRevisions(tx, systemCode)
+		if err != nil {
+			return nil, err
+		}
+
+		var configuration map[string]string
+		if revision != nil {
+			configuration, err = configurationAtRevision(current, revisions, *revision)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			configuration = configurationAtTime(current, revisions, *at)
+		}
+
+		schemas, err := readSystemConfigurationSchema(tx, systemCode)
+		if err != nil {
+			return nil, err
+		}
+
+		return maskConfiguration(typeConfiguration(schemas, configurationList(configuration))), nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return records.([]models.Configuration), nil
+}
+
+//Get the changes of the System configuration between two revisions
+func (svc *SystemsService) DiffSystemConfigurationRevisions(systemCode string, fromRevision int64, toRevision int64) ([]models.ConfigurationChange, error) {
+	session := svc.neo4jDriver.NewSession(neo4j.SessionConfig{})
+	defer session.Close()
+	records, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		current, err := readSystemConfiguration(tx, systemCode)
+		if err != nil {
+			return nil, err
+		}
+		revisions, err := readSystemConfigurationRevisions(tx, systemCode)
+		if err != nil {
+			return nil, err
+		}
+
+		from, err := configurationAtRevision(current, revisions, fromRevision)
+		if err != nil {
+			return nil, err
+		}
+		to, err := configurationAtRevision(current, revisions, toRevision)
+		if err != nil {
+			return nil, err
+		}
+
+		return maskConfigurationChanges(diffConfigurations(from, to)), nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return records.([]models.ConfigurationChange), nil
+}
+
+//Roll the System configuration back to the state after the revision. The rollback is recorded as a new revision.
+func (svc *SystemsService) RollbackSystemConfiguration(systemCode string, revision int64, username string) ([]models.ConfigurationChange, error) {
+	session := svc.neo4jDriver.NewSession(neo4j.SessionConfig{})
+	defer session.Close()
+	records, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		if err := lockSystemConfiguration(tx, systemCode); err != nil {
+			return nil, err
+		}
+		current, err := readSystemConfiguration(tx, systemCode)
+		if err != nil {
+			return nil, err
+		}
+		revisions, err := readSystemConfigurationRevisions(tx, systemCode)
+		if err != nil {
+			return nil, err
+		}
+
+		target, err := configurationAtRevision(current, revisions, revision)
+		if err != nil {
+			return nil, err
+		}
+
+		changes := diffConfigurations(current, target)
+		if err = validateSystemConfigurationChanges(tx, systemCode, changes, svc.secretCipher); err != nil {
+			return nil, err
+		}
+		err = writeSystemConfigurationChanges(tx, systemCode, changes, username)
+		if err != nil {
+			return nil, err
+		}
+
+		return maskConfigurationChanges(changes), nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return records.([]models.ConfigurationChange), nil
+}
+
+//Get the decrypted value of the secret configuration key. Every reveal is audited by a SecretAccess node,
+//which is not owned by the System so the audit outlives it.
+func (svc *SystemsService) RevealSystemConfigurationSecret(systemCode string, key string, username string) (models.Configuration, error) {
+	session := svc.neo4jDriver.NewSession(neo4j.SessionConfig{})
+	defer session.Close()
+	result, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		current, err := readSystemConfiguration(tx, systemCode)
+		if err != nil {
+			return nil, err
+		}
+		stored, ok := current[key]
+		if !ok || !isSecretConfigurationValue(stored) {
+			return nil, ErrConfigurationSecretNotFound
+		}
+		value, err := svc.secretCipher.decrypt(stored)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = tx.Run(`CREATE (:SecretAccess{systemCode: $systemCode, key: $key, username: $username, date: datetime()})`, map[string]interface{}{
+			"systemCode": systemCode,
+			"key":        key,
+			"username":   username,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return models.Configuration{Key: key, Value: value, Secret: true}, nil
+	})
+
+	if err != nil {
+		return models.Configuration{}, err
+	}
+
+	return result.(models.Configuration), nil
+}
+
+//Get the audited reveals of the secret configuration values of the System ordered from the oldest one, optionally of one key only.
+//The audit is kept also for the deleted Systems.
+func (svc *SystemsService) GetConfigurationSecretAccesses(systemCode string, key string) ([]models.SecretAccess, error) {
+	session := svc.neo4jDriver.NewSession(neo4j.SessionConfig{})
+	defer session.Close()
+	records, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		reader, err := tx.Run(`MATCH (a:SecretAccess{systemCode: $systemCode}) WHERE $key = '' OR a.key = $key 
+		RETURN a.systemCode, a.key, a.username, a.date ORDER BY a.date`, map[string]interface{}{
+			"systemCode": systemCode,
+			"key":        key,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		list := make([]models.SecretAccess, 0)
+		for reader.Next() {
+			values := reader.Record().Values
+			list = append(list, models.SecretAccess{SystemCode: values[0].(string), Key: values[1].(string), Username: values[2].(string), When: values[3].(time.Time)})
+		}
+		if err = reader.Err(); err != nil {
+			return nil, err
+		}
 
-func NewSystemsService(driver neo4j.Driver) ISystemsService {
-	return &SystemsService{
-		neo4jDriver: driver,
-	}
-}
+		return list, nil
+	})
 
-//Create new System. If parentSystemCode is specified, create also hierrarchical relationship to this parent System.
-func (svc *SystemsService) CreateNewSystem(system models.System) (*models.ResponseMessage, error) {
+	if err != nil {
+		return nil, err
+	}
 
-	result := models.ResponseMessage{Message: "System was succesfuly created."}
+	return records.([]models.SecretAccess), nil
+}
 
+//Set and remove configuration keys of all Systems matched by the request in one transaction. The changes of every System
+//are recorded as its own revision. If the changes are not valid for any System, nothing is applied.
+func (svc *SystemsService) ApplyBulkConfiguration(request models.BulkConfigurationRequest, dryRun bool, username string) (*models.BulkConfigurationResult, error) {
 	session := svc.neo4jDriver.NewSession(neo4j.SessionConfig{})
 	defer session.Close()
-	_, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+	records, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		targets, err := readBulkConfigurationTargets(tx, request)
+		if err != nil {
+			return nil, err
+		}
 
-		if system.ParentSystemCode == "" {
-			_, err := tx.Run(`CREATE (s:System { 
-			name: $name, 
-			code: $code		
-			}) 
-		RETURN id(s)`, map[string]interface{}{
-				"name": system.Name,
-				"code": system.Code,
-			})
-			if err != nil {
+		result := models.BulkConfigurationResult{DryRun: dryRun, Systems: make([]models.BulkConfigurationSystemResult, 0, len(targets))}
+		systemChanges := make([][]models.ConfigurationChange, 0, len(targets))
+		valid := true
+		for _, target := range targets {
+			systemResult := models.BulkConfigurationSystemResult{SystemCode: target.Code, SystemName: target.Name, Changes: make([]models.ConfigurationChange, 0)}
+
+			if err := lockSystemConfiguration(tx, target.Code); err != nil {
 				return nil, err
 			}
-			return nil, nil
-		} else {
-			_, err := tx.Run(`MATCH (parent:System{code:$parentCode})
-			CREATE (s:System {name: $name, code: $code })
-			CREATE (parent)-[:HAS_SUBSYSTEM]->(s)`, map[string]interface{}{
-				"name":       system.Name,
-				"code":       system.Code,
-				"parentCode": system.ParentSystemCode,
-			})
+			current, err := readSystemConfiguration(tx, target.Code)
 			if err != nil {
 				return nil, err
 			}
-			return nil, nil
+			changes, err := svc.configurationEntriesChanges(tx, target.Code, current, request.Set)
+			var validationErr *ConfigurationValidationError
+			if errors.As(err, &validationErr) {
+				systemResult.Errors = validationErr.Errors
+				valid = false
+			} else if err != nil {
+				return nil, err
+			}
+			for _, key := range request.Remove {
+				if oldValue, ok := current[key]; ok {
+					changes = append(changes, models.ConfigurationChange{Key: key, OldValue: &oldValue, Action: "deleted"})
+				}
+			}
+
+			systemChanges = append(systemChanges, changes)
+			systemResult.Changes = append(systemResult.Changes, maskConfigurationChanges(changes)...)
+			result.Systems = append(result.Systems, systemResult)
+		}
+
+		if dryRun || !valid {
+			return &result, nil
 		}
+		for i, target := range targets {
+			if err = writeSystemConfigurationChanges(tx, target.Code, systemChanges[i], username); err != nil {
+				return nil, err
+			}
+		}
+		result.Applied = true
 
+		return &result, nil
 	})
 
 	if err != nil {
 		return nil, err
 	}
 
-	return &result, nil
+	return records.(*models.BulkConfigurationResult), nil
 }
 
-func (svc *SystemsService) DeleteSystemByCode(systemCode string) (*models.ResponseMessage, error) {
-	result := models.ResponseMessage{Message: "System was succesfuly deleted."}
-
+//Save the current configuration of all Systems in the subtree as a named snapshot owned by the subtree root.
+//Secret values are stored encrypted as they are.
+func (svc *SystemsService) CreateConfigurationSnapshot(systemCode string, name string, username string) (*models.ConfigurationSnapshot, error) {
 	session := svc.neo4jDriver.NewSession(neo4j.SessionConfig{})
 	defer session.Close()
-	_, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
-		_, err := tx.Run(`MATCH (s:System{code: $code})
-		DETACH DELETE s`, map[string]interface{}{
-			"code": systemCode,
+	records, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		configurations, err := readSubtreeConfigurations(tx, systemCode)
+		if err != nil {
+			return nil, err
+		}
+		if _, _, err = readConfigurationSnapshot(tx, systemCode, name); err == nil {
+			return nil, ErrConfigurationSnapshotConflict
+		} else if !errors.Is(err, ErrConfigurationSnapshotNotFound) {
+			return nil, err
+		}
+
+		configurationsJSON, err := json.Marshal(configurations)
+		if err != nil {
+			return nil, err
+		}
+		systemCodes := make([]string, 0, len(configurations))
+		for code := range configurations {
+			systemCodes = append(systemCodes, code)
+		}
+		//the snapshot Systems are linked, so the snapshot is restored to them also after they are renamed
+		reader, err := tx.Run(`MATCH (root:System{code: $systemCode}) 
+		CREATE (root)-[:HAS_SNAPSHOT]->(snapshot:ConfigSnapshot{name: $name, date: datetime(), username: $username, systemCount: $systemCount, configurations: $configurations}) 
+		WITH snapshot 
+		UNWIND $systemCodes AS code 
+		MATCH (s:System{code: code}) 
+		CREATE (snapshot)-[:SNAPSHOT_OF{systemCode: code}]->(s) 
+		RETURN DISTINCT snapshot.date`, map[string]interface{}{
+			"systemCode":     systemCode,
+			"name":           name,
+			"username":       username,
+			"systemCount":    len(configurations),
+			"configurations": string(configurationsJSON),
+			"systemCodes":    systemCodes,
 		})
 		if err != nil {
 			return nil, err
 		}
-		return nil, nil
+		record, err := reader.Single()
+		if err != nil {
+			return nil, err
+		}
+
+		return &models.ConfigurationSnapshot{Name: name, SystemCode: systemCode, When: record.Values[0].(time.Time), Username: username, SystemCount: len(configurations)}, nil
 	})
 
 	if err != nil {
 		return nil, err
 	}
 
-	return &result, nil
+	return records.(*models.ConfigurationSnapshot), nil
 }
 
-func (svc *SystemsService) GetSystemByCode(systemCode string) (models.System, error) {
-
+//Get the configuration snapshots of the System subtree ordered from the oldest one
+func (svc *SystemsService) GetConfigurationSnapshots(systemCode string) ([]models.ConfigurationSnapshot, error) {
 	session := svc.neo4jDriver.NewSession(neo4j.SessionConfig{})
 	defer session.Close()
-	record, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
-		reader, err := tx.Run(`MATCH (s:System{code: $code}) return s.code, s.name`, map[string]interface{}{
-			"code": systemCode,
-		})
+	records, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		if _, err := readSystemConfiguration(tx, systemCode); err != nil {
+			return nil, err
+		}
+		return readConfigurationSnapshots(tx, systemCode)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return records.([]models.ConfigurationSnapshot), nil
+}
 
+//Compare the snapshot with another snapshot of the same subtree, or with the current configuration if to is empty
+func (svc *SystemsService) CompareConfigurationSnapshots(systemCode string, from string, to string) (*models.ConfigurationSnapshotComparison, error) {
+	session := svc.neo4jDriver.NewSession(neo4j.SessionConfig{})
+	defer session.Close()
+	records, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		current, err := readSubtreeConfigurations(tx, systemCode)
+		if err != nil {
+			return nil, err
+		}
+		fromConfigurations, fromDeleted, err := readConfigurationSnapshot(tx, systemCode, from)
 		if err != nil {
 			return nil, err
 		}
+		toConfigurations, toDeleted := current, make([]string, 0)
+		if to != "" {
+			toConfigurations, toDeleted, err = readConfigurationSnapshot(tx, systemCode, to)
+			if err != nil {
+				return nil, err
+			}
+		}
 
-		item := models.System{}
-		rec, err := reader.Single()
+		return &models.ConfigurationSnapshotComparison{
+			From:            from,
+			To:              to,
+			Systems:         maskSystemConfigurationChanges(diffSubtreeConfigurations(fromConfigurations, toConfigurations)),
+			OnlyFromSystems: missingSystemCodes(fromConfigurations, toConfigurations, fromDeleted),
+			OnlyToSystems:   missingSystemCodes(toConfigurations, fromConfigurations, toDeleted),
+		}, nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return records.(*models.ConfigurationSnapshotComparison), nil
+}
 
+//Restore the configuration of the subtree Systems from the snapshot in one transaction. Only the differences are written,
+//each as a new revision of the System. Systems created after the snapshot are not changed.
+func (svc *SystemsService) RestoreConfigurationSnapshot(systemCode string, name string, dryRun bool, username string) (*models.ConfigurationSnapshotRestoreResult, error) {
+	session := svc.neo4jDriver.NewSession(neo4j.SessionConfig{})
+	defer session.Close()
+	records, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		if err := lockSubtreeConfigurations(tx, systemCode); err != nil {
+			return nil, err
+		}
+		current, err := readSubtreeConfigurations(tx, systemCode)
+		if err != nil {
+			return nil, err
+		}
+		snapshot, deleted, err := readConfigurationSnapshot(tx, systemCode, name)
 		if err != nil {
 			return nil, err
 		}
-		item.Code = rec.Values[0].(string)
-		item.Name = rec.Values[1].(string)
 
-		return item, nil
+		systems := diffSubtreeConfigurations(current, snapshot)
+		if !dryRun {
+			for _, system := range systems {
+				if err = validateSystemConfigurationChanges(tx, system.SystemCode, system.Changes, svc.secretCipher); err != nil {
+					return nil, err
+				}
+				if err = writeSystemConfigurationChanges(tx, system.SystemCode, system.Changes, username); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		return &models.ConfigurationSnapshotRestoreResult{
+			Name:           name,
+			DryRun:         dryRun,
+			Systems:        maskSystemConfigurationChanges(systems),
+			MissingSystems: missingSystemCodes(snapshot, current, deleted),
+		}, nil
 	})
 
 	if err != nil {
-		return models.System{}, err
+		return nil, err
 	}
 
-	return record.(models.System), nil
+	return records.(*models.ConfigurationSnapshotRestoreResult), nil
 }
 
-func (svc *SystemsService) GetSystemsByNameOrCode(searchText string, limit int32) ([]models.System, error) {
-
+//Get time-value logs of the System. The time window is open-ended on the side where from or to is nil.
+func (svc *SystemsService) GetSystemTimeValueLogs(systemCode string, from *time.Time, to *time.Time) ([]models.TimeValueLog, error) {
 	session := svc.neo4jDriver.NewSession(neo4j.SessionConfig{})
 	defer session.Close()
 	records, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
-		reader, err := tx.Run(`call {
-			match(s:System) where ($searchText = '' or ((toLower(s.name) CONTAINS $searchText) or (toLower(s.code) CONTAINS $searchText))) and (not (s)<-[:HAS_SUBSYSTEM]-()) 
-			return s.name as name , s.code as code, '' as parent
-			union
-			match(s:System)<-[r:HAS_SUBSYSTEM]-(parent:System) where $searchText = '' or ((toLower(s.name) CONTAINS $searchText) or (toLower(s.code) CONTAINS $searchText)) 
-			return s.name as name, s.code as code, parent.name as parent 
-			}
-			return name, code, parent
-			limit $limit`, map[string]interface{}{
-			"searchText": searchText,
-			"limit":      limit,
+		reader, err := tx.Run(`match(s:System{code: $systemCode})-[]->(log:TimeValue) 
+		where ($from is null or log.time >= $from) 
+		and ($to is null or log.time <= $to) 
+		return log.time, log.value, log.unit order by log.time`, map[string]interface{}{
+			"systemCode": systemCode,
+			"from":       timeParam(from),
+			"to":         timeParam(to),
 		})
 
 		if err != nil {
 			return nil, err
 		}
 
-		list := make([]models.System, 0)
+		list := make([]models.TimeValueLog, 0)
 
 		for reader.Next() {
-			list = append(list, models.System{Name: reader.Record().Values[0].(string), Code: reader.Record().Values[1].(string), ParentSystemCode: reader.Record().Values[2].(string)})
+			list = append(list, models.TimeValueLog{Time: reader.Record().Values[0].(time.Time), Value: reader.Record().Values[1].(float64), Unit: reader.Record().Values[2].(string)})
 		}
 		if err = reader.Err(); err != nil {
 			return nil, err
@@ -170,25 +1763,50 @@ func (svc *SystemsService) GetSystemsByNameOrCode(searchText string, limit int32
 		return nil, err
 	}
 
-	return records.([]models.System), nil
+	return records.([]models.TimeValueLog), nil
 }
 
-func (svc *SystemsService) GetSystemMaintenance(systemCode string) ([]models.Maintenance, error) {
+//Get time-value logs of the System aggregated to time buckets in the database, or downsampled by LTTB for the lttb function.
+func (svc *SystemsService) GetSystemTimeValueLogsAggregated(systemCode string, from *time.Time, to *time.Time, aggregation models.TimeValueLogAggregation) ([]models.TimeValueLog, error) {
+	if aggregation.Function == "lttb" {
+		logs, err := svc.GetSystemTimeValueLogs(systemCode, from, to)
+		if err != nil {
+			return nil, err
+		}
+		return downsampleLTTB(logs, aggregation.Points), nil
+	}
+
+	valueExpression, ok := timeValueAggregationExpressions[aggregation.Function]
+	if !ok {
+		return nil, errors.New("Unknown aggregation function: " + aggregation.Function)
+	}
+
 	session := svc.neo4jDriver.NewSession(neo4j.SessionConfig{})
 	defer session.Close()
 	records, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
-		reader, err := tx.Run(`MATCH (s:System)-[m:WAS_MAINTAINED_BY]->(u:User) WHERE $systemCode = '' or s.code = $systemCode RETURN m.date, u.username, s.name`, map[string]interface{}{
-			"systemCode": systemCode,
+		reader, err := tx.Run(`match(s:System{code: $systemCode})-[]->(log:TimeValue) 
+		where ($from is null or log.time >= $from) 
+		and ($to is null or log.time <= $to) 
+		with (log.time.epochMillis / $bucketMillis) * $bucketMillis as bucket, log order by log.time 
+		return datetime({epochMillis: bucket}) as time, `+valueExpression+` as value, collect(log.unit)[0] as unit order by time`, map[string]interface{}{
+			"systemCode":   systemCode,
+			"from":         timeParam(from),
+			"to":           timeParam(to),
+			"bucketMillis": aggregation.Bucket.Milliseconds(),
 		})
 
 		if err != nil {
 			return nil, err
 		}
 
-		list := make([]models.Maintenance, 0)
+		list := make([]models.TimeValueLog, 0)
 
 		for reader.Next() {
-			list = append(list, models.Maintenance{When: reader.Record().Values[0].(time.Time), Username: reader.Record().Values[1].(string), SystemName: reader.Record().Values[2].(string)})
+			item := models.TimeValueLog{Time: reader.Record().Values[0].(time.Time), Value: reader.Record().Values[1].(float64), Unit: reader.Record().Values[2].(string)}
+			if aggregation.Function == "count" {
+				item.Unit = "count"
+			}
+			list = append(list, item)
 		}
 		if err = reader.Err(); err != nil {
 			return nil, err
@@ -201,37 +1819,50 @@ func (svc *SystemsService) GetSystemMaintenance(systemCode string) ([]models.Mai
 		return nil, err
 	}
 
-	return records.([]models.Maintenance), nil
+	return records.([]models.TimeValueLog), nil
 }
 
-func (svc *SystemsService) DeleteConfigurationByKeyAndSystemCode(systemCode string, key string) (*models.ResponseMessage, error) {
-	result := models.ResponseMessage{Message: "Configuration was succesfuly deleted."}
-
+//Get codes of the Systems which have some time-value logs, optionally filtered by code or name containing the search text.
+func (svc *SystemsService) GetSystemCodesWithTimeValueLogs(searchText string) ([]string, error) {
 	session := svc.neo4jDriver.NewSession(neo4j.SessionConfig{})
 	defer session.Close()
-	_, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
-		_, err := tx.Run(`match(s:System{code:$systemCode})-[]->(c:Config{key: $key}) detach delete c`, map[string]interface{}{
-			"systemCode": systemCode,
-			"key":        key,
+	records, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		reader, err := tx.Run(`match(s:System) where exists((s)-[:LOG]->(:TimeValue)) 
+		and ($searchText = '' or ((toLower(s.name) CONTAINS $searchText) or (toLower(s.code) CONTAINS $searchText))) 
+		return s.code order by s.code`, map[string]interface{}{
+			"searchText": searchText,
 		})
+
 		if err != nil {
 			return nil, err
 		}
-		return nil, nil
+
+		list := make([]string, 0)
+
+		for reader.Next() {
+			list = append(list, reader.Record().Values[0].(string))
+		}
+		if err = reader.Err(); err != nil {
+			return nil, err
+		}
+
+		return list, nil
 	})
 
 	if err != nil {
 		return nil, err
 	}
 
-	return &result, nil
+	return records.([]string), nil
 }
 
-func (svc *SystemsService) GetSystemConfigurationBySystemCode(systemCode string) ([]models.Configuration, error) {
+//Get codes of the System and all its subsystems in the whole subtree. The code of the System itself is the first one.
+func (svc *SystemsService) GetSubsystemCodes(systemCode string) ([]string, error) {
 	session := svc.neo4jDriver.NewSession(neo4j.SessionConfig{})
 	defer session.Close()
 	records, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
-		reader, err := tx.Run(`match(s:System{code: $systemCode})-[]->(c:Config) return c.key, c.value`, map[string]interface{}{
+		reader, err := tx.Run(`match p=(s:System{code: $systemCode})-[:HAS_SUBSYSTEM*0..]->(sub:System) 
+		return sub.code order by length(p)`, map[string]interface{}{
 			"systemCode": systemCode,
 		})
 
@@ -239,14 +1870,17 @@ func (svc *SystemsService) GetSystemConfigurationBySystemCode(systemCode string)
 			return nil, err
 		}
 
-		list := make([]models.Configuration, 0)
+		list := make([]string, 0)
 
 		for reader.Next() {
-			list = append(list, models.Configuration{Key: reader.Record().Values[0].(string), Value: reader.Record().Values[1].(string)})
+			list = append(list, reader.Record().Values[0].(string))
 		}
 		if err = reader.Err(); err != nil {
 			return nil, err
 		}
+		if len(list) == 0 {
+			return nil, ErrSystemNotFound
+		}
 
 		return list, nil
 	})
@@ -255,40 +1889,107 @@ func (svc *SystemsService) GetSystemConfigurationBySystemCode(systemCode string)
 		return nil, err
 	}
 
-	return records.([]models.Configuration), nil
+	return records.([]string), nil
 }
 
-func (svc *SystemsService) GetSystemTimeValueLogs(systemCode string) ([]models.TimeValueLog, error) {
+//Write a batch of time-value logs to the System in one transaction. Invalid points are rejected and reported, the valid ones are written.
+//The unit of the points has to be the same as the unit of the already logged values of the System.
+//Written points are published to the live stream subscribers after the transaction is committed.
+func (svc *SystemsService) CreateSystemTimeValueLogs(systemCode string, logs []models.TimeValueLog) (*models.TimeValueLogIngestResult, error) {
+	var accepted []models.TimeValueLog
+
 	session := svc.neo4jDriver.NewSession(neo4j.SessionConfig{})
 	defer session.Close()
-	records, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
-		reader, err := tx.Run(`match(s:System{code: $systemCode})-[]->(log:TimeValue) 
-		
-		return log.time, log.value, log.unit order by log.time`, map[string]interface{}{
+	result, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		accepted = make([]models.TimeValueLog, 0, len(logs))
+
+		reader, err := tx.Run(`match(s:System{code: $systemCode}) 
+		optional match(s)-[:LOG]->(log:TimeValue) 
+		with log order by log.time desc limit 1 
+		return log.unit`, map[string]interface{}{
 			"systemCode": systemCode,
 		})
-
 		if err != nil {
 			return nil, err
 		}
-
-		list := make([]models.TimeValueLog, 0)
-
-		for reader.Next() {
-			list = append(list, models.TimeValueLog{Time: reader.Record().Values[0].(time.Time), Value: reader.Record().Values[1].(float64), Unit: reader.Record().Values[2].(string)})
+		if !reader.Next() {
+			if err = reader.Err(); err != nil {
+				return nil, err
+			}
+			return nil, ErrSystemNotFound
 		}
-		if err = reader.Err(); err != nil {
-			return nil, err
+		unit, _ := reader.Record().Values[0].(string)
+
+		result := models.TimeValueLogIngestResult{Rejected: make([]models.RejectedTimeValueLog, 0)}
+		points := make([]interface{}, 0, len(logs))
+		maxTime := time.Now().Add(timeValueLogMaxClockSkew)
+
+		for i, log := range logs {
+			reason := ""
+			switch {
+			case log.Unit == "":
+				reason = "Missing unit"
+			case unit != "" && log.Unit != unit:
+				reason = "Unit does not match the unit of the System logs: " + unit
+			case log.Time.IsZero():
+				reason = "Missing time"
+			case log.Time.After(maxTime):
+				reason = "Time is in the future"
+			case math.IsNaN(log.Value) || math.IsInf(log.Value, 0):
+				reason = "Invalid value"
+			}
+			if reason != "" {
+				result.Rejected = append(result.Rejected, models.RejectedTimeValueLog{Index: i, Log: log, Reason: reason})
+				continue
+			}
+			//the first accepted point sets the unit for a System without logs
+			unit = log.Unit
+			accepted = append(accepted, log)
+			points = append(points, map[string]interface{}{
+				"time":  log.Time,
+				"value": log.Value,
+				"unit":  log.Unit,
+			})
 		}
 
-		return list, nil
+		if len(points) > 0 {
+			_, err = tx.Run(`match(s:System{code: $systemCode}) 
+			unwind $points as point 
+			create(log:TimeValue{unit: point.unit, time: point.time, value: point.value}) 
+			create(s)-[:LOG]->(log)`, map[string]interface{}{
+				"systemCode": systemCode,
+				"points":     points,
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+		result.Accepted = len(points)
+
+		return &result, nil
 	})
 
 	if err != nil {
 		return nil, err
 	}
 
-	return records.([]models.TimeValueLog), nil
+	if len(accepted) > 0 {
+		svc.timeValueBroadcaster.Publish(systemCode, accepted)
+	}
+
+	return result.(*models.TimeValueLogIngestResult), nil
+}
+
+//Migrate the data of the existing database once at the server start, nothing is changed when the data are up to date.
+//Maintenance logged before the ids were stored gets its id, the internal ids are reused after deletes so they are not stable.
+func (svc *SystemsService) MigrateDatabaseData() error {
+	session := svc.neo4jDriver.NewSession(neo4j.SessionConfig{})
+	defer session.Close()
+	_, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		_, err := tx.Run(`MATCH (:System)-[m:WAS_MAINTAINED_BY]->(:User) WHERE m.id IS NULL SET m.id = randomUUID()`, map[string]interface{}{})
+		return nil, err
+	})
+	return err
 }
 
 func (svc *SystemsService) RecreateDatabaseData() (*models.ResponseMessage, error) {
@@ -310,11 +2011,15 @@ func (svc *SystemsService) RecreateDatabaseData() (*models.ResponseMessage, erro
 
 	_, err = session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
 
-		_, err := tx.Run(`		
-		CREATE CONSTRAINT systemCodeUnique IF NOT EXISTS FOR (s:System) REQUIRE s.code IS UNIQUE;		
-		`, map[string]interface{}{})
-		if err != nil {
-			return nil, err
+		for _, constraint := range []string{
+			`CREATE CONSTRAINT systemCodeUnique IF NOT EXISTS FOR (s:System) REQUIRE s.code IS UNIQUE;`,
+			`CREATE CONSTRAINT userUsernameUnique IF NOT EXISTS FOR (u:User) REQUIRE u.username IS UNIQUE;`,
+			`CREATE CONSTRAINT userSubjectUnique IF NOT EXISTS FOR (u:User) REQUIRE u.subject IS UNIQUE;`,
+		} {
+			_, err := tx.Run(constraint, map[string]interface{}{})
+			if err != nil {
+				return nil, err
+			}
 		}
 
 		return nil, nil
@@ -334,9 +2039,9 @@ func (svc *SystemsService) RecreateDatabaseData() (*models.ResponseMessage, erro
 		CREATE (MOT2:System {name: 'Motor 2', code: 'L1CS1MOT2' })
 		CREATE (PS1:System {name: 'Pressure sensor 1', code: 'L1CS1PS1' })
 		CREATE (TS1:System {name: 'Temperature sensor 1', code: 'L1CS1TS1' })
-		CREATE (CAM1:System {name: 'Camera 1', code: 'L1CS1CAM1' })
-		CREATE (CAM2:System {name: 'Camera 2', code: 'L1CS1CAM2' })
-		CREATE (CAM3:System {name: 'Camera 3', code: 'L1CS1CAM3' })
+		CREATE (CAM1:System {name: 'Camera 1', code: 'L1CS1CAM1', type: 'camera' })
+		CREATE (CAM2:System {name: 'Camera 2', code: 'L1CS1CAM2', type: 'camera' })
+		CREATE (CAM3:System {name: 'Camera 3', code: 'L1CS1CAM3', type: 'camera' })
 		
 		
 		//create hierarchical realationships between systems
@@ -355,17 +2060,23 @@ func (svc *SystemsService) RecreateDatabaseData() (*models.ResponseMessage, erro
 		CREATE (CD1)-[:HAS_SUBSYSTEM]->(CAM3)
 		
 		//create users
-		CREATE (U1:User {username: 'Marie' })
-		CREATE (U2:User {username: 'Albert' })
+		CREATE (U1:User {username: 'Marie', displayName: 'Marie Curie', email: 'marie@example.com', team: 'Operations', active: true })
+		CREATE (U2:User {username: 'Albert', displayName: 'Albert Einstein', email: 'albert@example.com', team: 'Engineering', active: true })
 		
 		//create some maintenance
-		CREATE (CH1)-[:WAS_MAINTAINED_BY{date:datetime('2022-01-05T15:22')}]->(U1)
-		CREATE (CH1)-[:WAS_MAINTAINED_BY{date:datetime('2022-02-08T18:19')}]->(U2)
-		CREATE (CAM1)-[:WAS_MAINTAINED_BY{date:datetime('2022-09-26T10:54')}]->(U1)
-		CREATE (CAM3)-[:WAS_MAINTAINED_BY{date:datetime('2022-06-11T10:22')}]->(U2)
-		CREATE (TS1)-[:WAS_MAINTAINED_BY{date:datetime('2022-01-05T15:22')}]->(U1)
-		CREATE (TS1)-[:WAS_MAINTAINED_BY{date:datetime('2022-08-05T07:22')}]->(U2)
-		CREATE (TS1)-[:WAS_MAINTAINED_BY{date:datetime('2022-10-02T09:08')}]->(U1)
+		CREATE (CH1)-[:WAS_MAINTAINED_BY{id: randomUUID(), date:datetime('2022-01-05T15:22'), type: 'inspection'}]->(U1)
+		CREATE (CH1)-[:WAS_MAINTAINED_BY{id: randomUUID(), date:datetime('2022-02-08T18:19'), type: 'repair'}]->(U2)
+		CREATE (CAM1)-[:WAS_MAINTAINED_BY{id: randomUUID(), date:datetime('2022-09-26T10:54'), type: 'inspection'}]->(U1)
+		CREATE (CAM3)-[:WAS_MAINTAINED_BY{id: randomUUID(), date:datetime('2022-06-11T10:22'), type: 'calibration'}]->(U2)
+		CREATE (TS1)-[:WAS_MAINTAINED_BY{id: randomUUID(), date:datetime('2022-01-05T15:22'), type: 'inspection'}]->(U1)
+		CREATE (TS1)-[:WAS_MAINTAINED_BY{id: randomUUID(), date:datetime('2022-08-05T07:22'), type: 'repair'}]->(U2)
+		CREATE (TS1)-[:WAS_MAINTAINED_BY{id: randomUUID(), date:datetime('2022-10-02T09:08'), type: 'calibration'}]->(U1)
+		
+		//create configuration schema of the cameras
+		CREATE (:ConfigSchema {systemType: 'camera', key: 'ExposureMode', type: 'enum', values: ['timed', 'triggerWidth', 'off'] })
+		CREATE (:ConfigSchema {systemType: 'camera', key: 'ExposureTime-us', type: 'int', min: 10.0, max: 10000000.0, unit: 'us' })
+		CREATE (:ConfigSchema {systemType: 'camera', key: 'TriggerMode', type: 'enum', values: ['on', 'off'] })
+		CREATE (:ConfigSchema {systemType: 'camera', key: 'IP', type: 'ip' })
 		
 		//create some configuration for the system
 		CREATE (CFG1:Config {key: 'ExposureMode', value: 'timed' })
@@ -409,3 +2120,63 @@ func (svc *SystemsService) RecreateDatabaseData() (*models.ResponseMessage, erro
 
 	return &result, nil
 }
+
+func checkSystemExists(tx neo4j.Transaction, systemCode string) error {
+	reader, err := tx.Run(`MATCH (s:System{code: $code}) RETURN s.code`, map[string]interface{}{
+		"code": systemCode,
+	})
+	if err != nil {
+		return err
+	}
+	if !reader.Next() {
+		if err = reader.Err(); err != nil {
+			return err
+		}
+		return ErrSystemNotFound
+	}
+	return nil
+}
+
+//Neo4j driver does not know pointers, so optional string parameters are passed as nil or string value
+func stringParam(s *string) interface{} {
+	if s == nil {
+		return nil
+	}
+	return *s
+}
+
+//Unique constraint violation, e.g. of the System code, which could be created by a concurrent transaction
+func isConstraintViolation(err error) bool {
+	var neo4jError *neo4j.Neo4jError
+	return errors.As(err, &neo4jError) && neo4jError.Code == "Neo.ClientError.Schema.ConstraintValidationFailed"
+}
+
+//Neo4j driver does not know pointers, so optional number parameters are passed as nil or float64 value
+func floatParam(f *float64) interface{} {
+	if f == nil {
+		return nil
+	}
+	return *f
+}
+
+//Neo4j driver does not know pointers, so optional time parameters are passed as nil or time.Time value
+func timeParam(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return *t
+}
+
+//Maintenance from the record of date, username, System name, System code, id, type, description and duration
+func maintenanceFromRecord(record *neo4j.Record) models.Maintenance {
+	return models.Maintenance{
+		When:        record.Values[0].(time.Time),
+		Username:    record.Values[1].(string),
+		SystemName:  record.Values[2].(string),
+		SystemCode:  record.Values[3].(string),
+		Id:          record.Values[4].(string),
+		Type:        record.Values[5].(string),
+		Description: record.Values[6].(string),
+		Duration:    record.Values[7].(string),
+	}
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"math"
+	"panda/apigateway/models"
+)
+
+//Cypher aggregations computing the value of one bucket from its time ordered logs
+var timeValueAggregationExpressions = map[string]string{
+	"min":   "min(log.value)",
+	"max":   "max(log.value)",
+	"avg":   "avg(log.value)",
+	"count": "toFloat(count(log))",
+	"first": "collect(log.value)[0]",
+	"last":  "collect(log.value)[-1]",
+}
+
+//Largest-Triangle-Three-Buckets downsampling of the time ordered logs to the threshold number of points.
+//It keeps the first and the last point and from every bucket in between the point forming the largest triangle
+//with the previously selected point and the average of the next bucket, so the visual shape of the series is preserved.
+func downsampleLTTB(logs []models.TimeValueLog, threshold int) []models.TimeValueLog {
+	if threshold < 3 || len(logs) <= threshold {
+		return logs
+	}
+
+	sampled := make([]models.TimeValueLog, 0, threshold)
+	sampled = append(sampled, logs[0])
+
+	bucketSize := float64(len(logs)-2) / float64(threshold-2)
+	selected := 0
+
+	for i := 0; i < threshold-2; i++ {
+		//average point of the next bucket, the last point for the last bucket
+		nextStart := int(float64(i+1)*bucketSize) + 1
+		nextEnd := int(float64(i+2)*bucketSize) + 1
+		if nextEnd > len(logs) {
+			nextEnd = len(logs)
+		}
+		if nextStart >= nextEnd {
+			nextStart = nextEnd - 1
+		}
+		avgX, avgY := 0.0, 0.0
+		for _, log := range logs[nextStart:nextEnd] {
+			avgX += float64(log.Time.UnixMilli())
+			avgY += log.Value
+		}
+		avgX /= float64(nextEnd - nextStart)
+		avgY /= float64(nextEnd - nextStart)
+
+		//point of the current bucket with the largest triangle area
+		start := int(float64(i)*bucketSize) + 1
+		end := int(float64(i+1)*bucketSize) + 1
+		aX, aY := float64(logs[selected].Time.UnixMilli()), logs[selected].Value
+		maxArea := -1.0
+		maxIndex := start
+		for j := start; j < end; j++ {
+			area := math.Abs((aX-avgX)*(logs[j].Value-aY) - (aX-float64(logs[j].Time.UnixMilli()))*(avgY-aY))
+			if area > maxArea {
+				maxArea = area
+				maxIndex = j
+			}
+		}
+
+		sampled = append(sampled, logs[maxIndex])
+		selected = maxIndex
+	}
+
+	return append(sampled, logs[len(logs)-1])
+}
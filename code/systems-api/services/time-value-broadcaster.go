@@ -0,0 +1,93 @@
+package services
+
+import (
+	"panda/apigateway/models"
+	"sync"
+)
+
+//Buffer of the not yet sent events of one subscription. Slow consumers overflowing it are disconnected
+//and they can reconnect with replay from the time of the last received event.
+const timeValueSubscriptionBuffer = 256
+
+type TimeValueSubscription struct {
+	systemCodes map[string]bool
+	events      chan models.TimeValueLogEvent
+	overflowed  bool
+}
+
+//Channel of the new time-value logs. It is closed when the subscription is unsubscribed or overflowed.
+func (s *TimeValueSubscription) Events() <-chan models.TimeValueLogEvent {
+	return s.events
+}
+
+//Overflowed is valid after the events channel is closed
+func (s *TimeValueSubscription) Overflowed() bool {
+	return s.overflowed
+}
+
+type TimeValueBroadcaster struct {
+	mutex         sync.Mutex
+	subscriptions map[*TimeValueSubscription]bool
+}
+
+//In-process broadcaster of the newly written time-value logs to the live stream subscribers
+type ITimeValueBroadcaster interface {
+	Subscribe(systemCodes []string) *TimeValueSubscription
+	Unsubscribe(subscription *TimeValueSubscription)
+	Publish(systemCode string, logs []models.TimeValueLog)
+}
+
+func NewTimeValueBroadcaster() ITimeValueBroadcaster {
+	return &TimeValueBroadcaster{
+		subscriptions: make(map[*TimeValueSubscription]bool),
+	}
+}
+
+//Subscribe to the new time-value logs of the Systems
+func (b *TimeValueBroadcaster) Subscribe(systemCodes []string) *TimeValueSubscription {
+	subscription := &TimeValueSubscription{
+		systemCodes: make(map[string]bool, len(systemCodes)),
+		events:      make(chan models.TimeValueLogEvent, timeValueSubscriptionBuffer),
+	}
+	for _, code := range systemCodes {
+		subscription.systemCodes[code] = true
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.subscriptions[subscription] = true
+
+	return subscription
+}
+
+func (b *TimeValueBroadcaster) Unsubscribe(subscription *TimeValueSubscription) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.subscriptions[subscription] {
+		delete(b.subscriptions, subscription)
+		close(subscription.events)
+	}
+}
+
+//Publish the logs to the subscribers of the System. It never blocks, a subscriber with full buffer is disconnected.
+func (b *TimeValueBroadcaster) Publish(systemCode string, logs []models.TimeValueLog) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for subscription := range b.subscriptions {
+		if !subscription.systemCodes[systemCode] {
+			continue
+		}
+		for _, log := range logs {
+			select {
+			case subscription.events <- models.TimeValueLogEvent{SystemCode: systemCode, TimeValueLog: log}:
+			default:
+				subscription.overflowed = true
+				delete(b.subscriptions, subscription)
+				close(subscription.events)
+			}
+			if subscription.overflowed {
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package services
+
+import (
+	"errors"
+	"panda/apigateway/models"
+	"strings"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+var ErrUserNotFound = errors.New("User not found")
+var ErrUserConflict = errors.New("User with this username already exists")
+var ErrUserSubjectConflict = errors.New("Token subject is already linked to another user")
+var ErrUserInactive = errors.New("User is not active")
+
+//Returned properties of the User u, Users created before the properties were stored are active
+const userReturnProperties = `u.username, coalesce(u.displayName, ''), coalesce(u.email, ''), coalesce(u.team, ''), coalesce(u.active, true), coalesce(u.subject, '')`
+
+type UsersService struct {
+	neo4jDriver neo4j.Driver
+}
+
+type IUsersService interface {
+	GetUsers(active *bool) ([]models.User, error)
+	GetUserByUsername(username string) (models.User, error)
+	GetUserBySubject(subject string) (models.User, error)
+	CreateUser(user models.UserUpdate) (models.User, error)
+	UpdateUser(username string, update models.UserUpdate) (models.User, error)
+	DeleteUser(username string) (*models.ResponseMessage, error)
+}
+
+func NewUsersService(driver neo4j.Driver) IUsersService {
+	return &UsersService{neo4jDriver: driver}
+}
+
+//Get the Users ordered by username, optionally only the active or inactive ones
+func (svc *UsersService) GetUsers(active *bool) ([]models.User, error) {
+	session := svc.neo4jDriver.NewSession(neo4j.SessionConfig{})
+	defer session.Close()
+	records, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		reader, err := tx.Run(`MATCH (u:User) WHERE $active IS NULL OR coalesce(u.active, true) = $active
+		RETURN `+userReturnProperties+` ORDER BY u.username`, map[string]interface{}{
+			"active": boolParam(active),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		list := make([]models.User, 0)
+		for reader.Next() {
+			list = append(list, userFromRecord(reader.Record()))
+		}
+		if err = reader.Err(); err != nil {
+			return nil, err
+		}
+
+		return list, nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return records.([]models.User), nil
+}
+
+func (svc *UsersService) GetUserByUsername(username string) (models.User, error) {
+	return svc.getUser(`MATCH (u:User{username: $value})`, username)
+}
+
+//Get the User linked to the subject of the JWT token
+func (svc *UsersService) GetUserBySubject(subject string) (models.User, error) {
+	return svc.getUser(`MATCH (u:User{subject: $value})`, subject)
+}
+
+func (svc *UsersService) getUser(match string, value string) (models.User, error) {
+	session := svc.neo4jDriver.NewSession(neo4j.SessionConfig{})
+	defer session.Close()
+	result, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		return readUser(tx, match, value)
+	})
+
+	if err != nil {
+		return models.User{}, err
+	}
+
+	return result.(models.User), nil
+}
+
+//Create the User, new Users are active unless set otherwise
+func (svc *UsersService) CreateUser(user models.UserUpdate) (models.User, error) {
+	active := true
+	if user.Active != nil {
+		active = *user.Active
+	}
+
+	session := svc.neo4jDriver.NewSession(neo4j.SessionConfig{})
+	defer session.Close()
+	result, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		if _, err := readUser(tx, `MATCH (u:User{username: $value})`, *user.Username); err == nil {
+			return nil, ErrUserConflict
+		} else if !errors.Is(err, ErrUserNotFound) {
+			return nil, err
+		}
+		if err := checkUserSubject(tx, *user.Username, user.Subject); err != nil {
+			return nil, err
+		}
+
+		_, err := tx.Run(`CREATE (u:User{username: $username, displayName: $displayName, email: $email, team: $team, active: $active, subject: $subject})`, map[string]interface{}{
+			"username":    *user.Username,
+			"displayName": valueOrEmpty(user.DisplayName),
+			"email":       valueOrEmpty(user.Email),
+			"team":        valueOrEmpty(user.Team),
+			"active":      active,
+			"subject":     subjectParam(user.Subject),
+		})
+		if err != nil {
+			return nil, userConstraintError(err)
+		}
+
+		return readUser(tx, `MATCH (u:User{username: $value})`, *user.Username)
+	})
+
+	if err != nil {
+		return models.User{}, err
+	}
+
+	return result.(models.User), nil
+}
+
+//Update the not nil fields of the User. Empty subject unlinks the User from the JWT token subject.
+//The renamed User stays linked to its maintenance and maintenance plans.
+func (svc *UsersService) UpdateUser(username string, update models.UserUpdate) (models.User, error) {
+	session := svc.neo4jDriver.NewSession(neo4j.SessionConfig{})
+	defer session.Close()
+	result, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		if _, err := readUser(tx, `MATCH (u:User{username: $value})`, username); err != nil {
+			return nil, err
+		}
+		newUsername := username
+		if update.Username != nil && *update.Username != username {
+			newUsername = *update.Username
+			if _, err := readUser(tx, `MATCH (u:User{username: $value})`, newUsername); err == nil {
+				return nil, ErrUserConflict
+			} else if !errors.Is(err, ErrUserNotFound) {
+				return nil, err
+			}
+		}
+		if err := checkUserSubject(tx, username, update.Subject); err != nil {
+			return nil, err
+		}
+
+		_, err := tx.Run(`MATCH (u:User{username: $username})
+		SET u.username = $newUsername,
+		u.displayName = coalesce($displayName, u.displayName),
+		u.email = coalesce($email, u.email),
+		u.team = coalesce($team, u.team),
+		u.active = coalesce($active, u.active, true),
+		u.subject = CASE WHEN $subject IS NULL THEN u.subject WHEN $subject = '' THEN null ELSE $subject END
+		WITH u
+		OPTIONAL MATCH (p:MaintenancePlan{username: $username})
+		SET p.username = $newUsername`, map[string]interface{}{
+			"username":    username,
+			"newUsername": newUsername,
+			"displayName": stringParam(update.DisplayName),
+			"email":       stringParam(update.Email),
+			"team":        stringParam(update.Team),
+			"active":      boolParam(update.Active),
+			"subject":     stringParam(update.Subject),
+		})
+		if err != nil {
+			return nil, userConstraintError(err)
+		}
+
+		return readUser(tx, `MATCH (u:User{username: $value})`, newUsername)
+	})
+
+	if err != nil {
+		return models.User{}, err
+	}
+
+	return result.(models.User), nil
+}
+
+//Delete the User. Users referenced by maintenance or maintenance plans cannot be deleted, they are deactivated instead.
+func (svc *UsersService) DeleteUser(username string) (*models.ResponseMessage, error) {
+	result := models.ResponseMessage{Message: "User was succesfuly deleted."}
+
+	session := svc.neo4jDriver.NewSession(neo4j.SessionConfig{})
+	defer session.Close()
+	_, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		reader, err := tx.Run(`MATCH (u:User{username: $username})
+		OPTIONAL MATCH (p:MaintenancePlan{username: $username})
+		WITH u, count(p) AS plans
+		RETURN plans > 0 OR exists((u)<-[:WAS_MAINTAINED_BY]-())`, map[string]interface{}{
+			"username": username,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if !reader.Next() {
+			if err = reader.Err(); err != nil {
+				return nil, err
+			}
+			return nil, ErrUserNotFound
+		}
+		if reader.Record().Values[0].(bool) {
+			result.Message = "User is referenced by maintenance, it was deactivated instead."
+			_, err = tx.Run(`MATCH (u:User{username: $username}) SET u.active = false`, map[string]interface{}{
+				"username": username,
+			})
+			return nil, err
+		}
+
+		_, err = tx.Run(`MATCH (u:User{username: $username}) DETACH DELETE u`, map[string]interface{}{
+			"username": username,
+		})
+		return nil, err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func readUser(tx neo4j.Transaction, match string, value string) (models.User, error) {
+	reader, err := tx.Run(match+` RETURN `+userReturnProperties, map[string]interface{}{
+		"value": value,
+	})
+	if err != nil {
+		return models.User{}, err
+	}
+	if !reader.Next() {
+		if err = reader.Err(); err != nil {
+			return models.User{}, err
+		}
+		return models.User{}, ErrUserNotFound
+	}
+	return userFromRecord(reader.Record()), nil
+}
+
+//The JWT token subject can be linked to one User only
+func checkUserSubject(tx neo4j.Transaction, username string, subject *string) error {
+	if subject == nil || *subject == "" {
+		return nil
+	}
+	linked, err := readUser(tx, `MATCH (u:User{subject: $value})`, *subject)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if linked.Username != username {
+		return ErrUserSubjectConflict
+	}
+	return nil
+}
+
+//Unique constraint violations of the username and the subject of the User are told apart by the violated property
+func userConstraintError(err error) error {
+	if !isConstraintViolation(err) {
+		return err
+	}
+	var neo4jError *neo4j.Neo4jError
+	if errors.As(err, &neo4jError) && strings.Contains(neo4jError.Msg, "`subject`") {
+		return ErrUserSubjectConflict
+	}
+	return ErrUserConflict
+}
+
+func userFromRecord(record *neo4j.Record) models.User {
+	return models.User{
+		Username:    record.Values[0].(string),
+		DisplayName: record.Values[1].(string),
+		Email:       record.Values[2].(string),
+		Team:        record.Values[3].(string),
+		Active:      record.Values[4].(bool),
+		Subject:     record.Values[5].(string),
+	}
+}
+
+func valueOrEmpty(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+//Empty subject is not stored, so the unique constraint of the subjects ignores the Users without a subject
+func subjectParam(subject *string) interface{} {
+	if subject == nil || *subject == "" {
+		return nil
+	}
+	return *subject
+}
+
+//Neo4j driver does not know pointers, so optional bool parameters are passed as nil or bool value
+func boolParam(b *bool) interface{} {
+	if b == nil {
+		return nil
+	}
+	return *b
+}